@@ -0,0 +1,470 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	PolicyLRU    = "lru"    // 淘汰最近最少使用
+	PolicyLFU    = "lfu"    // 淘汰使用频率最低
+	PolicyARC    = "arc"    // 自适应替换（兼顾最近使用与使用频率）
+	PolicySimple = "simple" // 不按使用情况淘汰，容量满时随机淘汰，适合只依赖过期时间的场景
+)
+
+// defaultLoadTimeout GetOrLoad 调用loader 的默认超时时间
+const defaultLoadTimeout = 30 * time.Second
+
+// Option Cache 额外参数
+type Option[K comparable, V any] func(c *Cache[K, V])
+
+// WithPolicy 设置淘汰策略，参考Policy* 常量，默认LRU
+func WithPolicy[K comparable, V any](policy string) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.policy = policy
+	}
+}
+
+// WithExpiration 设置默认过期时间，<=0 表示不过期
+func WithExpiration[K comparable, V any](expiration time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.expiration = expiration
+	}
+}
+
+// WithJitter 设置过期时间的随机抖动，实际过期时间为[ttl, ttl+jitter)，避免大量key 同时过期
+func WithJitter[K comparable, V any](jitter time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.jitter = jitter
+	}
+}
+
+// WithLoader 设置默认loader，Get 未命中时调用
+func WithLoader[K comparable, V any](loader func(key K) (V, error)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.loader = loader
+	}
+}
+
+// WithLoadTimeout 设置GetOrLoad 调用loader 的超时时间，默认30s
+func WithLoadTimeout[K comparable, V any](timeout time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.loadTimeout = timeout
+	}
+}
+
+// WithName 设置缓存名称，用于指标及日志
+func WithName[K comparable, V any](name string) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.name = name
+	}
+}
+
+// WithDebugLog 开启debug 日志（Remove、Purge 等操作），默认关闭
+func WithDebugLog[K comparable, V any](enable bool) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.debug = enable
+	}
+}
+
+// WithAddedFunc 设置写入缓存时的回调
+/**
+回调在缓存内部锁中同步执行，不能在回调中再操作该缓存。
+*/
+func WithAddedFunc[K comparable, V any](f func(key K, value V)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onAdded = f
+	}
+}
+
+// WithEvictedFunc 设置因容量（或字节上限）不足被淘汰时的回调（Remove、Purge 不会触发）
+/**
+回调在缓存内部锁中同步执行，不能在回调中再操作该缓存。
+*/
+func WithEvictedFunc[K comparable, V any](f func(key K, value V)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onEvicted = f
+	}
+}
+
+// WithExpiredFunc 设置过期数据被清除时的回调
+/**
+过期数据在下一次访问该key 时才会被清除；回调在缓存内部锁中同步执行，不能在回调中再操作该缓存。
+*/
+func WithExpiredFunc[K comparable, V any](f func(key K, value V)) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.onExpired = f
+	}
+}
+
+// Cache 泛型本地缓存
+type Cache[K comparable, V any] struct {
+	cache      store         // gcache 缓存，字节上限模式下为sizedStore
+	capacity   int           // Cache 最大缓冲容量
+	expiration time.Duration // Cache 缓存过期时间
+	policy     string
+	jitter     time.Duration
+	loader     func(key K) (V, error)
+	name       string
+	debug      bool
+
+	maxBytes int64
+	sizer    func(key K, value V) int64
+	shards   int
+
+	onAdded   func(key K, value V)
+	onEvicted func(key K, value V)
+	onExpired func(key K, value V)
+
+	evictions   uint64
+	expirations uint64
+	removing    sync.Map // 正在Remove 的key，淘汰回调中据此区分主动删除
+
+	mu          sync.Mutex
+	calls       map[K]*loadCall[V] // GetOrLoad 正在进行的加载
+	loadTimeout time.Duration
+
+	snapshotPath     string
+	snapshotFormat   string
+	snapshotInterval time.Duration
+	stopCh           chan struct{}
+	closeOnce        sync.Once
+	wg               sync.WaitGroup
+}
+
+// entry 缓存中实际存储的数据，记录过期时间用于区分过期与淘汰
+type entry[V any] struct {
+	value    V
+	expireAt time.Time
+}
+
+// detachedContext 保留父ctx 的值，但不继承其取消及deadline
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// detach 获取脱离取消的ctx，用于多个调用者共享的加载
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+// loadCall 一次加载
+type loadCall[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// New 新建缓存
+/**
+例如：cache.New[string, *User](1024, cache.WithPolicy[string, *User](cache.PolicyLFU))
+*/
+func New[K comparable, V any](capacity int, options ...Option[K, V]) (*Cache[K, V], error) {
+	if capacity <= 0 {
+		return nil, errors.New("[cache]capacity must be positive")
+	}
+
+	c := &Cache[K, V]{capacity: capacity, policy: PolicyLRU, calls: make(map[K]*loadCall[V]), loadTimeout: defaultLoadTimeout}
+	for _, f := range options {
+		f(c)
+	}
+
+	if c.maxBytes > 0 {
+		s, err := c.newSizedStore()
+		if err != nil {
+			return nil, err
+		}
+		c.cache = s
+		if err := c.initSnapshot(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	builder := gcache.New(capacity)
+	switch c.policy {
+	case PolicyLRU:
+		builder = builder.LRU()
+	case PolicyLFU:
+		builder = builder.LFU()
+	case PolicyARC:
+		builder = builder.ARC()
+	case PolicySimple:
+		builder = builder.Simple()
+	default:
+		return nil, errors.New("[cache]unknown policy '" + c.policy + "'")
+	}
+	if c.loader != nil {
+		builder = builder.LoaderExpireFunc(func(key interface{}) (interface{}, *time.Duration, error) {
+			v, err := c.loader(key.(K))
+			if err != nil {
+				return nil, nil, err
+			}
+			ttl := c.ttl(c.expiration)
+			return c.wrap(v, ttl), ttl, nil
+		})
+	}
+
+	// 通过GetClient 直接读写gcache 时同样透明地包装/解包
+	builder = builder.SerializeFunc(func(key, value interface{}) (interface{}, error) {
+		if e, ok := value.(*entry[V]); ok {
+			return e, nil
+		}
+		v, _ := value.(V)
+		return &entry[V]{value: v}, nil
+	}).DeserializeFunc(func(key, value interface{}) (interface{}, error) {
+		return c.unwrap(value), nil
+	}).AddedFunc(func(key, value interface{}) {
+		if c.onAdded != nil {
+			c.onAdded(key.(K), c.unwrap(value))
+		}
+	}).EvictedFunc(c.evicted)
+	c.cache = builder.Build()
+
+	if err := c.initSnapshot(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ttl 计算带有随机抖动的过期时间，返回nil 表示不过期
+func (c *Cache[K, V]) ttl(expiration time.Duration) *time.Duration {
+	if expiration <= 0 {
+		return nil
+	}
+	if c.jitter > 0 {
+		expiration += time.Duration(rand.Int63n(int64(c.jitter)))
+	}
+	return &expiration
+}
+
+// wrap 包装为entry
+func (c *Cache[K, V]) wrap(value V, ttl *time.Duration) *entry[V] {
+	e := &entry[V]{value: value}
+	if ttl != nil {
+		e.expireAt = time.Now().Add(*ttl)
+	}
+	return e
+}
+
+// unwrap 获取entry 中的数据
+func (c *Cache[K, V]) unwrap(value interface{}) V {
+	if e, ok := value.(*entry[V]); ok {
+		return e.value
+	}
+	v, _ := value.(V)
+	return v
+}
+
+// evicted gcache 淘汰回调（容量淘汰、过期清除、Remove 均会触发）
+func (c *Cache[K, V]) evicted(key, value interface{}) {
+	if _, ok := c.removing.Load(key); ok {
+		return
+	}
+
+	k := key.(K)
+	e, _ := value.(*entry[V])
+	if e != nil && !e.expireAt.IsZero() && !time.Now().Before(e.expireAt) {
+		atomic.AddUint64(&c.expirations, 1)
+		if c.onExpired != nil {
+			c.onExpired(k, e.value)
+		}
+		return
+	}
+
+	atomic.AddUint64(&c.evictions, 1)
+	if c.onEvicted != nil {
+		c.onEvicted(k, c.unwrap(value))
+	}
+}
+
+// GetClient 获取cache client，字节上限模式下返回nil
+func (c *Cache[K, V]) GetClient() gcache.Cache {
+	gc, _ := c.cache.(gcache.Cache)
+	return gc
+}
+
+// Get 根据key 获取缓存数据，未命中时调用WithLoader 设置的loader
+/**
+key 不存在、已过期或者loader 返回错误时返回false。
+*/
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	if _, ok := c.cache.(*sizedStore); ok && c.loader != nil {
+		v, err := c.GetOrLoad(context.Background(), key, func(ctx context.Context, key K) (V, error) {
+			return c.loader(key)
+		})
+		return v, err == nil
+	}
+
+	v, err := c.cache.Get(key)
+	if err != nil {
+		var zero V
+		return zero, false
+	}
+	// 调用loader 时gcache 直接返回loader 的结果（未经过DeserializeFunc）
+	return c.unwrap(v), true
+}
+
+// GetIfExist 根据key 获取缓存数据，不会调用loader
+func (c *Cache[K, V]) GetIfExist(key K) (V, bool) {
+	v, err := c.cache.GetIFPresent(key)
+	if err != nil {
+		var zero V
+		return zero, false
+	}
+	return c.unwrap(v), true
+}
+
+// GetOrLoad 根据key 获取缓存数据，未命中时调用loader 加载并写入缓存
+/**
+并发未命中同一个key 时只调用一次loader；loader 使用脱离调用者取消的ctx（保留ctx 中的值）并按WithLoadTimeout 超时，
+调用者的ctx 取消只会结束自己的等待，不影响其他等待者。loader 返回错误或panic 时不写入缓存并返回该错误。
+*/
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, loader func(ctx context.Context, key K) (V, error)) (V, error) {
+	if v, ok := c.GetIfExist(key); ok {
+		return v, nil
+	}
+
+	var zero V
+	if loader == nil {
+		return zero, ErrNotFound
+	}
+
+	c.mu.Lock()
+	call, ok := c.calls[key]
+	if !ok {
+		call = &loadCall[V]{done: make(chan struct{})}
+		c.calls[key] = call
+		go c.load(detach(ctx), key, loader, call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case <-call.done:
+		return call.val, call.err
+	}
+}
+
+// load 调用loader 加载并写入缓存
+func (c *Cache[K, V]) load(ctx context.Context, key K, loader func(ctx context.Context, key K) (V, error), call *loadCall[V]) {
+	if c.loadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.loadTimeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			var zero V
+			call.val, call.err = zero, fmt.Errorf("[cache]loader panic: %v", r)
+		}
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.val, call.err = loader(ctx, key)
+	if call.err == nil {
+		call.err = c.Set(key, call.val)
+	}
+}
+
+// GetAll 获取全部缓存
+/**
+checkExpired：是否校验过期key
+*/
+func (c *Cache[K, V]) GetAll(checkExpired bool) map[K]V {
+	all := c.cache.GetALL(checkExpired)
+	m := make(map[K]V, len(all))
+	for k, v := range all {
+		m[k.(K)] = c.unwrap(v)
+	}
+	return m
+}
+
+// Set 根据key 设置缓存数据，使用默认过期时间（带有随机抖动）
+func (c *Cache[K, V]) Set(key K, value V) error {
+	return c.SetWithExpire(key, value, c.expiration)
+}
+
+// SetWithExpire 根据key 设置缓存数据（存在过期时间，带有随机抖动）
+func (c *Cache[K, V]) SetWithExpire(key K, value V, expiration time.Duration) error {
+	return c.set(key, value, c.ttl(expiration))
+}
+
+// set 根据key 设置缓存数据，ttl 为nil 时不过期
+func (c *Cache[K, V]) set(key K, value V, ttl *time.Duration) error {
+	if ttl != nil {
+		return c.cache.SetWithExpire(key, c.wrap(value, ttl), *ttl)
+	}
+	return c.cache.Set(key, c.wrap(value, nil))
+}
+
+// Remove 根据key 删除缓存，返回key 是否存在
+func (c *Cache[K, V]) Remove(key K) bool {
+	c.removing.Store(key, struct{}{})
+	ok := c.cache.Remove(key)
+	c.removing.Delete(key)
+
+	if c.debug {
+		logrus.Debugf("[gcache]%s'%v' removed.", c.logName(), key)
+	}
+	return ok
+}
+
+// Purge 清除全部缓存
+func (c *Cache[K, V]) Purge() {
+	c.cache.Purge()
+	if c.debug {
+		logrus.Debugf("[gcache]%spurged.", c.logName())
+	}
+}
+
+// logName 日志中的缓存名称
+func (c *Cache[K, V]) logName() string {
+	if c.name == "" {
+		return ""
+	}
+	return "'" + c.name + "' "
+}
+
+// Keys 获取全部keys
+/**
+checkExpired：是否校验过期key
+*/
+func (c *Cache[K, V]) Keys(checkExpired bool) []K {
+	keys := c.cache.Keys(checkExpired)
+	ks := make([]K, len(keys))
+	for i := range keys {
+		ks[i] = keys[i].(K)
+	}
+	return ks
+}
+
+// Len 获取缓存的长度
+/**
+checkExpired：是否校验过期key
+*/
+func (c *Cache[K, V]) Len(checkExpired bool) int {
+	return c.cache.Len(checkExpired)
+}
+
+// Has 获取缓存是否存在key
+func (c *Cache[K, V]) Has(key K) bool {
+	return c.cache.Has(key)
+}
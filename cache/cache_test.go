@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cacheTestUser struct {
+	Name string
+}
+
+func TestNew(t *testing.T) {
+	for _, policy := range []string{PolicyLRU, PolicyLFU, PolicyARC, PolicySimple} {
+		c, err := New[string, *cacheTestUser](2, WithPolicy[string, *cacheTestUser](policy))
+		if err != nil {
+			t.Errorf("New cache err: %v.", err)
+			return
+		}
+
+		if err := c.Set("key_1", &cacheTestUser{Name: "user_1"}); err != nil {
+			t.Errorf("Cache set err: %v.", err)
+			return
+		}
+		v, ok := c.Get("key_1")
+		if !ok || v.Name != "user_1" {
+			t.Errorf("Cache '%s' get unexpected value: %v, %v.", policy, v, ok)
+			return
+		}
+		if _, ok := c.Get("key_2"); ok {
+			t.Errorf("Cache '%s' get missing key should return false.", policy)
+			return
+		}
+	}
+
+	if _, err := New[string, int](2, WithPolicy[string, int]("unknown")); err == nil {
+		t.Errorf("Unknown policy should return err.")
+		return
+	}
+}
+
+func TestWithLoader(t *testing.T) {
+	errNotFound := errors.New("not found")
+	c, err := New[int, string](10, WithLoader[int, string](func(key int) (string, error) {
+		if key < 0 {
+			return "", errNotFound
+		}
+		return "value", nil
+	}))
+	if err != nil {
+		t.Errorf("New cache err: %v.", err)
+		return
+	}
+
+	if v, ok := c.Get(1); !ok || v != "value" {
+		t.Errorf("Cache get with loader unexpected value: %v, %v.", v, ok)
+		return
+	}
+	if _, ok := c.Get(-1); ok {
+		t.Errorf("Cache get with loader err should return false.")
+		return
+	}
+	if _, ok := c.GetIfExist(2); ok {
+		t.Errorf("Cache get if exist should not call loader.")
+		return
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	c, err := New[string, int](10, WithExpiration[string, int](time.Second), WithJitter[string, int](time.Second))
+	if err != nil {
+		t.Errorf("New cache err: %v.", err)
+		return
+	}
+
+	// 并发未命中时只调用一次loader
+	var loads int32
+	loader := func(ctx context.Context, key string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(50 * time.Millisecond)
+		return 1, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.GetOrLoad(context.Background(), "key", loader); err != nil || v != 1 {
+				t.Errorf("Cache get or load unexpected value: %v, %v.", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("Cache get or load loads: %d.", n)
+		return
+	}
+
+	if _, err := c.GetOrLoad(context.Background(), "missing", nil); err != ErrNotFound {
+		t.Errorf("Cache get or load without loader err: %v.", err)
+		return
+	}
+
+	// 第一个调用者取消不影响加载
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := c.GetOrLoad(ctx, "detached", func(ctx context.Context, key string) (int, error) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return 2, ctx.Err()
+	}); err != context.Canceled {
+		t.Errorf("Cache get or load canceled err: %v.", err)
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+	if v, ok := c.GetIfExist("detached"); !ok || v != 2 {
+		t.Errorf("Cache get or load detached value: %v, %v.", v, ok)
+		return
+	}
+
+	// loader panic 转为错误
+	if _, err := c.GetOrLoad(context.Background(), "panic", func(ctx context.Context, key string) (int, error) {
+		panic("boom")
+	}); err == nil {
+		t.Errorf("Cache get or load panic should return err.")
+		return
+	}
+}
+
+func TestStats(t *testing.T) {
+	var evicted, expired []string
+	c, err := New[string, int](2,
+		WithName[string, int]("test"),
+		WithEvictedFunc[string, int](func(key string, value int) { evicted = append(evicted, key) }),
+		WithExpiredFunc[string, int](func(key string, value int) { expired = append(expired, key) }),
+	)
+	if err != nil {
+		t.Errorf("New cache err: %v.", err)
+		return
+	}
+
+	// 容量为2，写入第3 个key 时淘汰key_1
+	_ = c.Set("key_1", 1)
+	_ = c.Set("key_2", 2)
+	_ = c.Set("key_3", 3)
+
+	// 过期
+	_ = c.SetWithExpire("key_2", 2, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("key_2"); ok {
+		t.Errorf("Cache get expired key should return false.")
+		return
+	}
+
+	// Remove 不计入淘汰
+	c.Remove("key_3")
+	if _, ok := c.Get("key_3"); ok {
+		t.Errorf("Cache get removed key should return false.")
+		return
+	}
+
+	s := c.Stats()
+	if s.Evictions != 1 || s.Expirations != 1 || s.Misses != 2 || s.Size != 0 {
+		t.Errorf("Cache unexpected stats: %+v.", s)
+		return
+	}
+	if len(evicted) != 1 || evicted[0] != "key_1" || len(expired) != 1 || expired[0] != "key_2" {
+		t.Errorf("Cache unexpected callbacks, evicted: %v, expired: %v.", evicted, expired)
+		return
+	}
+
+	var buf strings.Builder
+	if err := c.WritePrometheus(&buf); err != nil {
+		t.Errorf("Cache write prometheus err: %v.", err)
+		return
+	}
+	if !strings.Contains(buf.String(), `cache_evictions_total{cache="test"} 1`) {
+		t.Errorf("Cache unexpected prometheus output: %s.", buf.String())
+		return
+	}
+}
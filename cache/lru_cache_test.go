@@ -29,11 +29,11 @@ func TestGet(t *testing.T) {
 		return
 	}
 
-	value := cache.Get("key_2")
+	value, _ := cache.Get("key_2")
 	t.Log(value)
 
 	time.Sleep(time.Duration(3) * time.Second)
-	valueAfterSleep := cache.Get("key_2")
+	valueAfterSleep, _ := cache.Get("key_2")
 	t.Log(valueAfterSleep)
 }
 
@@ -46,11 +46,11 @@ func TestSetWithExpire(t *testing.T) {
 		return
 	}
 
-	value := cache.Get("key_3")
+	value, _ := cache.Get("key_3")
 	t.Log(value)
 
 	time.Sleep(time.Duration(5) * time.Second)
-	valueAfterSleep := cache.Get("key_3")
+	valueAfterSleep, _ := cache.Get("key_3")
 	t.Log(valueAfterSleep)
 }
 
@@ -64,12 +64,12 @@ func TestPurge(t *testing.T) {
 		return
 	}
 
-	value := cache.Get("key_4")
+	value, _ := cache.Get("key_4")
 	t.Log(value)
 
 	cache.Purge()
 
-	valueAfterPurge := cache.Get("key_4")
+	valueAfterPurge, _ := cache.Get("key_4")
 	t.Log(valueAfterPurge)
 }
 
@@ -82,11 +82,11 @@ func TestGetIFPresent(t *testing.T) {
 		return
 	}
 
-	value := cache.GetIfExist("key_5")
+	value, _ := cache.GetIfExist("key_5")
 	t.Log(value)
 
 	time.Sleep(time.Duration(3) * time.Second)
-	valueAfterSleep := cache.GetIfExist("key_5")
+	valueAfterSleep, _ := cache.GetIfExist("key_5")
 	t.Log(valueAfterSleep)
 }
 
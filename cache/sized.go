@@ -0,0 +1,376 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+const defaultShards = 16
+
+// ErrEntryTooLarge 单条数据的大小超过字节上限
+var ErrEntryTooLarge = errors.New("[cache]entry too large")
+
+// store 缓存底层存储，gcache.Cache 与sizedStore 均实现该接口
+type store interface {
+	Set(key, value interface{}) error
+	SetWithExpire(key, value interface{}, expiration time.Duration) error
+	Get(key interface{}) (interface{}, error)
+	GetIFPresent(key interface{}) (interface{}, error)
+	GetALL(checkExpired bool) map[interface{}]interface{}
+	Remove(key interface{}) bool
+	Purge()
+	Keys(checkExpired bool) []interface{}
+	Len(checkExpired bool) int
+	Has(key interface{}) bool
+	HitCount() uint64
+	MissCount() uint64
+}
+
+// WithMaxBytes 开启字节上限模式，全部数据的大小之和不超过maxBytes，超过时按LRU 淘汰
+/**
+字节上限模式下忽略WithPolicy（固定为分片LRU），capacity 仍然限制数据条数；
+全部分片共享maxBytes，超过时按访问顺序淘汰全部分片中最久未使用的数据，大小超过maxBytes 的数据写入时返回ErrEntryTooLarge。
+*/
+func WithMaxBytes[K comparable, V any](maxBytes int64) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.maxBytes = maxBytes
+	}
+}
+
+// WithSizer 设置计算数据大小（字节）的函数，默认使用msgpack 序列化后的长度（[]byte、string 直接取长度，无法序列化时按格式化后的长度估算）
+func WithSizer[K comparable, V any](sizer func(key K, value V) int64) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.sizer = sizer
+	}
+}
+
+// WithShards 设置字节上限模式的分片数量，默认16，分片越多锁竞争越少
+func WithShards[K comparable, V any](shards int) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.shards = shards
+	}
+}
+
+// defaultSizer 默认的数据大小计算
+func defaultSizer[K comparable, V any](key K, value V) int64 {
+	switch v := any(value).(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	}
+
+	b, err := msgpack.Marshal(value)
+	if err != nil {
+		// 返回0 会使字节上限失效，按格式化后的长度估算
+		if n := int64(len(fmt.Sprint(value))); n > 0 {
+			return n
+		}
+		return 1
+	}
+	return int64(len(b))
+}
+
+// newSizedStore 根据Cache 的配置新建sizedStore
+func (c *Cache[K, V]) newSizedStore() (*sizedStore, error) {
+	if c.shards <= 0 {
+		c.shards = defaultShards
+	}
+	if c.sizer == nil {
+		c.sizer = defaultSizer[K, V]
+	}
+	s := &sizedStore{
+		shards:   make([]*sizedShard, c.shards),
+		maxBytes: c.maxBytes,
+		cost: func(key, value interface{}) int64 {
+			return c.sizer(key.(K), c.unwrap(value))
+		},
+		added: func(key, value interface{}) {
+			if c.onAdded != nil {
+				c.onAdded(key.(K), c.unwrap(value))
+			}
+		},
+		evicted: c.evicted,
+	}
+	maxEntries := (c.capacity + c.shards - 1) / c.shards
+	for i := range s.shards {
+		s.shards[i] = &sizedShard{
+			store:      s,
+			maxEntries: maxEntries,
+			items:      make(map[interface{}]*list.Element),
+			ll:         list.New(),
+		}
+	}
+	return s, nil
+}
+
+// sizedStore 按字节上限淘汰的分片LRU
+type sizedStore struct {
+	shards   []*sizedShard
+	maxBytes int64
+	bytes    int64  // 全部分片的数据大小之和，原子操作
+	clock    uint64 // 访问序号，原子操作，用于跨分片比较最久未使用的数据
+	cost     func(key, value interface{}) int64
+	added    func(key, value interface{})
+	evicted  func(key, value interface{})
+
+	hits   uint64
+	misses uint64
+}
+
+// sizedShard 分片
+type sizedShard struct {
+	store      *sizedStore
+	mu         sync.Mutex
+	maxEntries int
+	items      map[interface{}]*list.Element
+	ll         *list.List // 头部为最近使用
+}
+
+// sizedItem 分片中的一条数据
+type sizedItem struct {
+	key      interface{}
+	value    interface{}
+	cost     int64
+	expireAt time.Time
+	access   uint64 // 最后一次访问的序号，持有分片锁时读写
+}
+
+func (it *sizedItem) expired(now time.Time) bool {
+	return !it.expireAt.IsZero() && !now.Before(it.expireAt)
+}
+
+var shardSeed = maphash.MakeSeed()
+
+// shard 根据key 选择分片
+func (s *sizedStore) shard(key interface{}) *sizedShard {
+	var h uint64
+	switch k := key.(type) {
+	case string:
+		h = maphash.String(shardSeed, k)
+	case int:
+		h = uint64(k) * 0x9E3779B97F4A7C15
+	case int64:
+		h = uint64(k) * 0x9E3779B97F4A7C15
+	case uint64:
+		h = k * 0x9E3779B97F4A7C15
+	case int32:
+		h = uint64(k) * 0x9E3779B97F4A7C15
+	case uint32:
+		h = uint64(k) * 0x9E3779B97F4A7C15
+	default:
+		h = maphash.String(shardSeed, fmt.Sprintf("%T:%v", key, key))
+	}
+	return s.shards[h%uint64(len(s.shards))]
+}
+
+func (s *sizedStore) Set(key, value interface{}) error {
+	return s.set(key, value, time.Time{})
+}
+
+func (s *sizedStore) SetWithExpire(key, value interface{}, expiration time.Duration) error {
+	return s.set(key, value, time.Now().Add(expiration))
+}
+
+func (s *sizedStore) set(key, value interface{}, expireAt time.Time) error {
+	cost := s.cost(key, value)
+	if cost > s.maxBytes {
+		return ErrEntryTooLarge
+	}
+
+	sh := s.shard(key)
+	sh.mu.Lock()
+	var it *sizedItem
+	if e, ok := sh.items[key]; ok {
+		it = e.Value.(*sizedItem)
+		atomic.AddInt64(&s.bytes, cost-it.cost)
+		it.value, it.cost, it.expireAt = value, cost, expireAt
+		sh.ll.MoveToFront(e)
+	} else {
+		it = &sizedItem{key: key, value: value, cost: cost, expireAt: expireAt}
+		sh.items[key] = sh.ll.PushFront(it)
+		atomic.AddInt64(&s.bytes, cost)
+	}
+	it.access = atomic.AddUint64(&s.clock, 1)
+
+	// 条数上限按分片计算
+	for sh.maxEntries > 0 && sh.ll.Len() > sh.maxEntries {
+		sh.removeElement(sh.ll.Back())
+	}
+	if s.added != nil {
+		s.added(key, value)
+	}
+	sh.mu.Unlock()
+
+	s.evictOldest(it)
+	return nil
+}
+
+// evictOldest 淘汰全部分片中最久未使用的数据直到满足字节上限，不会淘汰刚写入的数据keep
+/**
+每次比较各分片尾部数据的访问序号，只淘汰最小的一条，每次只持有一个分片锁。
+*/
+func (s *sizedStore) evictOldest(keep *sizedItem) {
+	for atomic.LoadInt64(&s.bytes) > s.maxBytes {
+		var (
+			oldest *sizedShard
+			access uint64
+		)
+		for _, sh := range s.shards {
+			sh.mu.Lock()
+			if e := sh.ll.Back(); e != nil {
+				if it := e.Value.(*sizedItem); it != keep && (oldest == nil || it.access < access) {
+					oldest, access = sh, it.access
+				}
+			}
+			sh.mu.Unlock()
+		}
+		if oldest == nil {
+			return
+		}
+		oldest.evictBack(access)
+	}
+}
+
+// evictBack 尾部数据的访问序号仍为access 时淘汰（比较期间可能已被访问或删除）
+func (sh *sizedShard) evictBack(access uint64) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if e := sh.ll.Back(); e != nil && e.Value.(*sizedItem).access == access {
+		sh.removeElement(e)
+	}
+}
+
+// Get 与GetIFPresent 一致，loader 由Cache 处理
+func (s *sizedStore) Get(key interface{}) (interface{}, error) {
+	return s.GetIFPresent(key)
+}
+
+func (s *sizedStore) GetIFPresent(key interface{}) (interface{}, error) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	if e, ok := sh.items[key]; ok {
+		it := e.Value.(*sizedItem)
+		if !it.expired(time.Now()) {
+			it.access = atomic.AddUint64(&s.clock, 1)
+			sh.ll.MoveToFront(e)
+			sh.mu.Unlock()
+			atomic.AddUint64(&s.hits, 1)
+			return it.value, nil
+		}
+		sh.removeElement(e)
+	}
+	sh.mu.Unlock()
+
+	atomic.AddUint64(&s.misses, 1)
+	return nil, gcache.KeyNotFoundError
+}
+
+func (s *sizedStore) GetALL(checkExpired bool) map[interface{}]interface{} {
+	now := time.Now()
+	m := make(map[interface{}]interface{})
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for k, e := range sh.items {
+			if it := e.Value.(*sizedItem); !checkExpired || !it.expired(now) {
+				m[k] = it.value
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return m
+}
+
+func (s *sizedStore) Remove(key interface{}) bool {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	e, ok := sh.items[key]
+	if ok {
+		sh.removeElement(e)
+	}
+	return ok
+}
+
+func (s *sizedStore) Purge() {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, e := range sh.items {
+			atomic.AddInt64(&s.bytes, -e.Value.(*sizedItem).cost)
+		}
+		sh.items = make(map[interface{}]*list.Element)
+		sh.ll.Init()
+		sh.mu.Unlock()
+	}
+}
+
+func (s *sizedStore) Keys(checkExpired bool) []interface{} {
+	now := time.Now()
+	keys := make([]interface{}, 0)
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for k, e := range sh.items {
+			if !checkExpired || !e.Value.(*sizedItem).expired(now) {
+				keys = append(keys, k)
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return keys
+}
+
+func (s *sizedStore) Len(checkExpired bool) int {
+	if checkExpired {
+		return len(s.Keys(true))
+	}
+
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		n += len(sh.items)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+func (s *sizedStore) Has(key interface{}) bool {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	e, ok := sh.items[key]
+	return ok && !e.Value.(*sizedItem).expired(time.Now())
+}
+
+func (s *sizedStore) HitCount() uint64 {
+	return atomic.LoadUint64(&s.hits)
+}
+
+func (s *sizedStore) MissCount() uint64 {
+	return atomic.LoadUint64(&s.misses)
+}
+
+// Bytes 当前数据大小之和
+func (s *sizedStore) Bytes() int64 {
+	return atomic.LoadInt64(&s.bytes)
+}
+
+// removeElement 删除数据并触发淘汰回调，调用前需要持有分片锁
+func (sh *sizedShard) removeElement(e *list.Element) {
+	it := sh.ll.Remove(e).(*sizedItem)
+	delete(sh.items, it.key)
+	atomic.AddInt64(&sh.store.bytes, -it.cost)
+	if sh.store.evicted != nil {
+		sh.store.evicted(it.key, it.value)
+	}
+}
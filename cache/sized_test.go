@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWithMaxBytes(t *testing.T) {
+	var evicted int
+	c, err := New[string, []byte](1000,
+		WithMaxBytes[string, []byte](100),
+		WithShards[string, []byte](1),
+		WithEvictedFunc[string, []byte](func(key string, value []byte) { evicted++ }))
+	if err != nil {
+		t.Errorf("New sized cache err: %v.", err)
+		return
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := c.Set("key_"+strconv.Itoa(i), make([]byte, 30)); err != nil {
+			t.Errorf("Cache set err: %v.", err)
+			return
+		}
+	}
+	// 100 字节只能保留3 条，最早写入的被淘汰
+	if s := c.Stats(); s.Size != 3 || s.Bytes != 90 || evicted != 2 {
+		t.Errorf("Sized cache unexpected stats: %+v, evicted %d.", s, evicted)
+		return
+	}
+	if c.Has("key_0") || !c.Has("key_4") {
+		t.Errorf("Sized cache should evict least recently used.")
+		return
+	}
+
+	if err := c.Set("key_large", make([]byte, 101)); err != ErrEntryTooLarge {
+		t.Errorf("Set entry too large unexpected err: %v.", err)
+		return
+	}
+
+	c.Remove("key_4")
+	if s := c.Stats(); s.Bytes != 60 || evicted != 2 {
+		t.Errorf("Sized cache unexpected stats after remove: %+v, evicted %d.", s, evicted)
+		return
+	}
+}
+
+func TestWithSizer(t *testing.T) {
+	c, err := New[int, *cacheTestUser](1000,
+		WithMaxBytes[int, *cacheTestUser](1024),
+		WithShards[int, *cacheTestUser](4),
+		WithSizer[int, *cacheTestUser](func(key int, value *cacheTestUser) int64 { return 16 }),
+		WithLoader[int, *cacheTestUser](func(key int) (*cacheTestUser, error) {
+			return &cacheTestUser{Name: "user_" + strconv.Itoa(key)}, nil
+		}))
+	if err != nil {
+		t.Errorf("New sized cache err: %v.", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if v, ok := c.Get(j); !ok || v.Name != "user_"+strconv.Itoa(j) {
+					t.Errorf("Sized cache get unexpected value: %v, %v.", v, ok)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if s := c.Stats(); s.Bytes > 1024 || s.Bytes != int64(s.Size)*16 {
+		t.Errorf("Sized cache exceeds max bytes: %+v.", s)
+		return
+	}
+}
+
+func TestWithMaxBytesShared(t *testing.T) {
+	c, err := New[string, []byte](1000,
+		WithMaxBytes[string, []byte](100),
+		WithShards[string, []byte](16))
+	if err != nil {
+		t.Errorf("New sized cache err: %v.", err)
+		return
+	}
+
+	// 分片共享字节上限，单条数据可以使用全部maxBytes
+	if err := c.Set("key_large", make([]byte, 90)); err != nil {
+		t.Errorf("Cache set large entry err: %v.", err)
+		return
+	}
+	for i := 0; i < 10; i++ {
+		if err := c.Set("key_"+strconv.Itoa(i), make([]byte, 20)); err != nil {
+			t.Errorf("Cache set err: %v.", err)
+			return
+		}
+		if s := c.Stats(); s.Bytes > 100 {
+			t.Errorf("Sized cache exceeds max bytes: %+v.", s)
+			return
+		}
+	}
+
+	if n := defaultSizer[string, func()]("key", func() {}); n <= 0 {
+		t.Errorf("Default sizer should not return %d for unmarshalable value.", n)
+		return
+	}
+}
+
+func TestWithMaxBytesLRU(t *testing.T) {
+	var evicted []int
+	c, err := New[int, []byte](1000,
+		WithMaxBytes[int, []byte](80),
+		WithShards[int, []byte](4),
+		WithEvictedFunc[int, []byte](func(key int, value []byte) { evicted = append(evicted, key) }))
+	if err != nil {
+		t.Errorf("New sized cache err: %v.", err)
+		return
+	}
+
+	// int key 按key%4 分片，0-7 每个分片2 条
+	for i := 0; i < 8; i++ {
+		if err := c.Set(i, make([]byte, 10)); err != nil {
+			t.Errorf("Cache set err: %v.", err)
+			return
+		}
+	}
+	if _, ok := c.Get(0); !ok {
+		t.Errorf("Cache get 0 miss.")
+		return
+	}
+
+	// 8、9 分别写入0、1 分片，淘汰全部分片中最久未使用的1、2，而不是写入分片中的数据
+	for i := 8; i < 10; i++ {
+		if err := c.Set(i, make([]byte, 10)); err != nil {
+			t.Errorf("Cache set err: %v.", err)
+			return
+		}
+	}
+	if len(evicted) != 2 || evicted[0] != 1 || evicted[1] != 2 {
+		t.Errorf("Sized cache evicted: %v, want [1 2].", evicted)
+		return
+	}
+	for _, key := range []int{0, 3, 4, 5, 8, 9} {
+		if !c.Has(key) {
+			t.Errorf("Sized cache should keep key %d.", key)
+			return
+		}
+	}
+}
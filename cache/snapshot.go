@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+const (
+	SnapshotFormatGob     = "gob"     // encoding/gob，interface{} 类型的value 需要提前gob.Register
+	SnapshotFormatMsgpack = "msgpack" // msgpack v4
+
+	snapshotVersion = 1
+)
+
+// snapshotMagic 快照文件头
+var snapshotMagic = []byte("GCSNAP")
+
+var snapshotFormats = map[string]byte{SnapshotFormatGob: 1, SnapshotFormatMsgpack: 2}
+
+/**
+快照文件格式：
+	magic（6 字节）| version（1 字节）| format（1 字节）| 保存时间（unix 纳秒，8 字节，大端）| body
+body 为gob/msgpack 编码的[]snapshotEntry。
+*/
+
+// snapshotEntry 快照中的一条数据
+type snapshotEntry[K comparable, V any] struct {
+	Key   K
+	Value V
+	TTL   int64 // 保存时的剩余过期时间（纳秒），0 表示不过期
+}
+
+// WithSnapshot 设置快照文件，New 时从文件预热，interval > 0 时后台定期保存，Close 时保存最后一次
+/**
+format 参考SnapshotFormat* 常量，读取时以文件头中的格式为准。
+*/
+func WithSnapshot[K comparable, V any](path, format string, interval time.Duration) Option[K, V] {
+	return func(c *Cache[K, V]) {
+		c.snapshotPath = path
+		c.snapshotFormat = format
+		c.snapshotInterval = interval
+	}
+}
+
+// initSnapshot New 时从快照预热，并启动后台定期保存
+func (c *Cache[K, V]) initSnapshot() error {
+	if c.snapshotPath == "" {
+		return nil
+	}
+	if _, ok := snapshotFormats[c.snapshotFormat]; !ok {
+		return fmt.Errorf("[cache]unknown snapshot format '%s'", c.snapshotFormat)
+	}
+
+	n, err := c.LoadSnapshotFile(c.snapshotPath)
+	if err != nil {
+		// 快照损坏时不影响启动
+		logrus.Errorf("[cache]%sload snapshot '%s' err: %v.", c.logName(), c.snapshotPath, err)
+	} else if c.debug {
+		logrus.Debugf("[cache]%sloaded %d entries from snapshot '%s'.", c.logName(), n, c.snapshotPath)
+	}
+
+	c.stopCh = make(chan struct{})
+	if c.snapshotInterval > 0 {
+		c.wg.Add(1)
+		go c.snapshotLoop()
+	}
+	return nil
+}
+
+// snapshotLoop 后台定期保存快照
+func (c *Cache[K, V]) snapshotLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			if err := c.SaveSnapshotFile(c.snapshotPath, c.snapshotFormat); err != nil {
+				logrus.Errorf("[cache]%ssave snapshot '%s' err: %v.", c.logName(), c.snapshotPath, err)
+			}
+		}
+	}
+}
+
+// Close 停止后台定期保存，配置了快照文件时保存最后一次快照
+func (c *Cache[K, V]) Close() error {
+	if c.stopCh == nil {
+		return nil
+	}
+
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stopCh)
+		c.wg.Wait()
+		err = c.SaveSnapshotFile(c.snapshotPath, c.snapshotFormat)
+	})
+	return err
+}
+
+// SaveSnapshot 将未过期的数据及剩余过期时间写入w，返回写入的数量
+func (c *Cache[K, V]) SaveSnapshot(w io.Writer, format string) (int, error) {
+	f, ok := snapshotFormats[format]
+	if !ok {
+		return 0, fmt.Errorf("[cache]unknown snapshot format '%s'", format)
+	}
+
+	now := time.Now()
+	all := c.cache.GetALL(true)
+	entries := make([]snapshotEntry[K, V], 0, len(all))
+	for k, v := range all {
+		e := snapshotEntry[K, V]{Key: k.(K)}
+		if en, ok := v.(*entry[V]); ok {
+			e.Value = en.value
+			if !en.expireAt.IsZero() {
+				if e.TTL = int64(en.expireAt.Sub(now)); e.TTL <= 0 {
+					continue
+				}
+			}
+		} else {
+			e.Value = c.unwrap(v)
+		}
+		entries = append(entries, e)
+	}
+
+	header := make([]byte, 0, len(snapshotMagic)+10)
+	header = append(header, snapshotMagic...)
+	header = append(header, snapshotVersion, f)
+	header = binary.BigEndian.AppendUint64(header, uint64(now.UnixNano()))
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header); err != nil {
+		return 0, err
+	}
+
+	var err error
+	if format == SnapshotFormatGob {
+		err = gob.NewEncoder(bw).Encode(entries)
+	} else {
+		err = msgpack.NewEncoder(bw).Encode(entries)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), bw.Flush()
+}
+
+// LoadSnapshot 从r 读取快照并写入缓存，跳过已过期的数据，返回写入的数量
+func (c *Cache[K, V]) LoadSnapshot(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(snapshotMagic)+10)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, err
+	}
+	if string(header[:len(snapshotMagic)]) != string(snapshotMagic) {
+		return 0, errors.New("[cache]invalid snapshot header")
+	}
+	header = header[len(snapshotMagic):]
+	if header[0] != snapshotVersion {
+		return 0, fmt.Errorf("[cache]unsupported snapshot version %d", header[0])
+	}
+	savedAt := time.Unix(0, int64(binary.BigEndian.Uint64(header[2:])))
+
+	var (
+		entries []snapshotEntry[K, V]
+		err     error
+	)
+	switch header[1] {
+	case snapshotFormats[SnapshotFormatGob]:
+		err = gob.NewDecoder(br).Decode(&entries)
+	case snapshotFormats[SnapshotFormatMsgpack]:
+		err = msgpack.NewDecoder(br).Decode(&entries)
+	default:
+		err = fmt.Errorf("[cache]unknown snapshot format %d", header[1])
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	elapsed := time.Since(savedAt)
+	n := 0
+	for _, e := range entries {
+		var ttl *time.Duration
+		if e.TTL > 0 {
+			remaining := time.Duration(e.TTL) - elapsed
+			if remaining <= 0 {
+				continue
+			}
+			ttl = &remaining
+		}
+		if err := c.set(e.Key, e.Value, ttl); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// SaveSnapshotFile 保存快照到文件（先写入临时文件再重命名，避免写入过程中被读取到不完整的快照）
+func (c *Cache[K, V]) SaveSnapshotFile(path, format string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := c.SaveSnapshot(tmp, format); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshotFile 从文件读取快照，文件不存在时返回0, nil
+func (c *Cache[K, V]) LoadSnapshotFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return c.LoadSnapshot(f)
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type snapshotTestUser struct {
+	Name string
+	Age  int
+}
+
+func TestSnapshot(t *testing.T) {
+	for _, format := range []string{SnapshotFormatGob, SnapshotFormatMsgpack} {
+		c, err := New[string, snapshotTestUser](10)
+		if err != nil {
+			t.Errorf("New cache err: %v.", err)
+			return
+		}
+		_ = c.Set("key_1", snapshotTestUser{Name: "user_1", Age: 1})
+		_ = c.SetWithExpire("key_2", snapshotTestUser{Name: "user_2", Age: 2}, time.Minute)
+		_ = c.SetWithExpire("key_3", snapshotTestUser{Name: "user_3", Age: 3}, 10*time.Millisecond)
+
+		var buf bytes.Buffer
+		if n, err := c.SaveSnapshot(&buf, format); err != nil || n != 3 {
+			t.Errorf("Save snapshot '%s' unexpected result: %d, %v.", format, n, err)
+			return
+		}
+
+		// key_3 在加载时已过期
+		time.Sleep(20 * time.Millisecond)
+		loaded, _ := New[string, snapshotTestUser](10)
+		if n, err := loaded.LoadSnapshot(&buf); err != nil || n != 2 {
+			t.Errorf("Load snapshot '%s' unexpected result: %d, %v.", format, n, err)
+			return
+		}
+		if v, ok := loaded.Get("key_1"); !ok || v.Name != "user_1" || v.Age != 1 {
+			t.Errorf("Load snapshot '%s' unexpected value: %+v, %v.", format, v, ok)
+			return
+		}
+		if _, ok := loaded.Get("key_3"); ok {
+			t.Errorf("Load snapshot '%s' should skip expired key.", format)
+			return
+		}
+	}
+}
+
+func TestWithSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	c, err := New[string, int](10, WithSnapshot[string, int](path, SnapshotFormatMsgpack, time.Hour))
+	if err != nil {
+		t.Errorf("New cache err: %v.", err)
+		return
+	}
+	_ = c.Set("key_1", 1)
+	if err := c.Close(); err != nil {
+		t.Errorf("Cache close err: %v.", err)
+		return
+	}
+
+	// 重启后从快照预热
+	warm, err := New[string, int](10, WithSnapshot[string, int](path, SnapshotFormatMsgpack, 0))
+	if err != nil {
+		t.Errorf("New cache err: %v.", err)
+		return
+	}
+	defer warm.Close()
+	if v, ok := warm.Get("key_1"); !ok || v != 1 {
+		t.Errorf("Warm start unexpected value: %v, %v.", v, ok)
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// labelEscaper Prometheus label 转义
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Stats 缓存统计
+type Stats struct {
+	Hits        uint64 // 命中次数
+	Misses      uint64 // 未命中次数
+	Evictions   uint64 // 因容量不足被淘汰的数量
+	Expirations uint64 // 过期被清除的数量
+	Size        int    // 当前缓存数量（包括未清除的过期数据）
+	Bytes       int64  // 当前数据大小之和（仅字节上限模式）
+}
+
+// HitRate 命中率
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Stats 获取缓存统计
+func (c *Cache[K, V]) Stats() Stats {
+	var bytes int64
+	if s, ok := c.cache.(*sizedStore); ok {
+		bytes = s.Bytes()
+	}
+	return Stats{
+		Hits:        c.cache.HitCount(),
+		Misses:      c.cache.MissCount(),
+		Evictions:   atomic.LoadUint64(&c.evictions),
+		Expirations: atomic.LoadUint64(&c.expirations),
+		Size:        c.cache.Len(false),
+		Bytes:       bytes,
+	}
+}
+
+// WritePrometheus 以Prometheus 文本格式输出缓存统计，可以直接挂载在/metrics 中
+/**
+输出的指标：
+	cache_hits_total{cache="name"}
+	cache_misses_total{cache="name"}
+	cache_evictions_total{cache="name"}
+	cache_expirations_total{cache="name"}
+	cache_size{cache="name"}
+	cache_bytes{cache="name"}（仅字节上限模式有值）
+多个缓存共用一个/metrics 时，需要通过WithName 设置不同的名称，并使用WritePrometheusMetrics 一次输出（避免重复的HELP/TYPE）。
+*/
+func (c *Cache[K, V]) WritePrometheus(w io.Writer) error {
+	return WritePrometheusMetrics(w, map[string]Stats{c.name: c.Stats()})
+}
+
+// WritePrometheusMetrics 以Prometheus 文本格式输出多个缓存的统计，key 为缓存名称
+func WritePrometheusMetrics(w io.Writer, stats map[string]Stats) error {
+	metrics := []struct {
+		name  string
+		typ   string
+		help  string
+		value func(s Stats) string
+	}{
+		{"cache_hits_total", "counter", "Number of cache hits.", func(s Stats) string { return strconv.FormatUint(s.Hits, 10) }},
+		{"cache_misses_total", "counter", "Number of cache misses.", func(s Stats) string { return strconv.FormatUint(s.Misses, 10) }},
+		{"cache_evictions_total", "counter", "Number of entries evicted due to capacity.", func(s Stats) string { return strconv.FormatUint(s.Evictions, 10) }},
+		{"cache_expirations_total", "counter", "Number of expired entries removed.", func(s Stats) string { return strconv.FormatUint(s.Expirations, 10) }},
+		{"cache_size", "gauge", "Number of entries in the cache.", func(s Stats) string { return strconv.Itoa(s.Size) }},
+		{"cache_bytes", "gauge", "Total size of entries in bytes.", func(s Stats) string { return strconv.FormatInt(s.Bytes, 10) }},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ); err != nil {
+			return err
+		}
+		for name, s := range stats {
+			if _, err := fmt.Fprintf(w, "%s{cache=\"%s\"} %s\n", m.name, labelEscaper.Replace(name), m.value(s)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/psoKnight/go-common/redis"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound 数据不存在（loader 返回该错误时会进行负缓存）
+var ErrNotFound = errors.New("[cache]not found")
+
+// negativeValue 本地负缓存标记
+type negativeValue struct{}
+
+// negativeMarker redis 中的负缓存标记
+/**
+0xc1 在msgpack 中保留不用，也不是合法的JSON/protobuf，不会与正常数据冲突。
+*/
+var negativeMarker = []byte{0xc1}
+
+// Loader 从数据源加载数据，数据不存在时返回ErrNotFound
+type Loader func(ctx context.Context, key string) (interface{}, error)
+
+type TieredCacheConfig struct {
+	Name          string        `json:"name"`           // 缓存名称，redis key 为"CACHE:"+name+":"+key
+	LocalCapacity int           `json:"local_capacity"` // 本地LRU 容量，默认1024
+	LocalTTL      time.Duration `json:"local_ttl"`      // 本地缓存过期时间，默认1min
+	RedisTTL      time.Duration `json:"redis_ttl"`      // redis 缓存过期时间，默认10min
+	NegativeTTL   time.Duration `json:"negative_ttl"`   // 负缓存过期时间，默认30s，<0 表示不进行负缓存
+	LoadTimeout   time.Duration `json:"load_timeout"`   // 访问redis/loader 的超时时间，默认30s
+}
+
+// TieredCache 两级缓存：本地LRU -> redis -> loader
+/**
+1. 并发未命中同一个key 时只有一个请求访问redis/loader（singleflight）；
+2. loader 返回ErrNotFound 时在本地及redis 中进行负缓存，避免缓存穿透；
+3. Set/Delete 通过redis Pub/Sub 广播失效消息，其他实例删除本地缓存。
+失效消息与加载并发时本地可能短暂保留旧数据，最长不超过LocalTTL。
+*/
+type TieredCache struct {
+	cfg      *TieredCacheConfig
+	local    *Cache[string, interface{}]
+	cli      *redis.Redis
+	newValue func() interface{}
+	loader   Loader
+
+	prefix     string
+	channel    string
+	instanceID string
+	group      singleflight.Group
+	sub        *redis.Subscriber
+}
+
+// NewTieredCache 新建两级缓存
+/**
+newValue 返回用于反序列化redis 数据的指针，例如func() interface{} { return &User{} }，
+Get 返回的数据与newValue、loader 返回的类型一致；loader 为nil 时只读取缓存。
+*/
+func NewTieredCache(cfg *TieredCacheConfig, client *redis.Redis, newValue func() interface{}, loader Loader) (*TieredCache, error) {
+	if cfg == nil || cfg.Name == "" {
+		return nil, errors.New("[cache]tiered cache name is empty")
+	}
+	if client == nil || newValue == nil {
+		return nil, errors.New("[cache]redis client or newValue is nil")
+	}
+
+	c := *cfg
+	if c.LocalCapacity <= 0 {
+		c.LocalCapacity = 1024
+	}
+	if c.LocalTTL <= 0 {
+		c.LocalTTL = time.Minute
+	}
+	if c.RedisTTL <= 0 {
+		c.RedisTTL = 10 * time.Minute
+	}
+	if c.NegativeTTL == 0 {
+		c.NegativeTTL = 30 * time.Second
+	}
+	if c.LoadTimeout <= 0 {
+		c.LoadTimeout = defaultLoadTimeout
+	}
+
+	local, err := New[string, interface{}](c.LocalCapacity,
+		WithName[string, interface{}](c.Name), WithExpiration[string, interface{}](c.LocalTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &TieredCache{
+		cfg:        &c,
+		local:      local,
+		cli:        client,
+		newValue:   newValue,
+		loader:     loader,
+		prefix:     "CACHE:" + c.Name + ":",
+		channel:    "CACHE:INVALIDATE:" + c.Name,
+		instanceID: uuid.NewV4().String(),
+	}
+
+	tc.sub = client.NewSubscriber(tc.onInvalidate, 0)
+	if err := tc.sub.Subscribe(tc.channel); err != nil {
+		_ = tc.sub.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// Get 获取数据，依次查询本地缓存、redis、loader，数据不存在时返回ErrNotFound
+/**
+共享的加载使用脱离调用者取消的ctx 并按LoadTimeout 超时，调用者的ctx 取消只会结束自己的等待。
+*/
+func (tc *TieredCache) Get(ctx context.Context, key string) (interface{}, error) {
+	if v, ok := tc.local.GetIfExist(key); ok {
+		if _, ok := v.(negativeValue); ok {
+			return nil, ErrNotFound
+		}
+		return v, nil
+	}
+
+	ch := tc.group.DoChan(key, func() (v interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				v, err = nil, fmt.Errorf("[cache]tiered cache load panic: %v", r)
+			}
+		}()
+
+		lctx, cancel := context.WithTimeout(detach(ctx), tc.cfg.LoadTimeout)
+		defer cancel()
+		return tc.load(lctx, key)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		return res.Val, res.Err
+	}
+}
+
+// load 本地缓存未命中时从redis、loader 加载
+func (tc *TieredCache) load(ctx context.Context, key string) (interface{}, error) {
+	reply, err := tc.cli.ExecCommandCtx(ctx, "GET", tc.prefix+key)
+	if err != nil {
+		// redis 不可用时降级到loader
+		logrus.Errorf("[cache]tiered cache '%s' get '%s' from redis err: %v.", tc.cfg.Name, key, err)
+	} else if b, ok := reply.([]byte); ok {
+		if bytes.Equal(b, negativeMarker) {
+			tc.setLocalNegative(key)
+			return nil, ErrNotFound
+		}
+
+		v := tc.newValue()
+		if err := tc.cli.Decode(b, v); err == nil {
+			_ = tc.local.Set(key, v)
+			return v, nil
+		}
+		logrus.Errorf("[cache]tiered cache '%s' decode '%s' err: %v.", tc.cfg.Name, key, err)
+	}
+
+	if tc.loader == nil {
+		return nil, ErrNotFound
+	}
+	v, err := tc.loader(ctx, key)
+	if err == ErrNotFound {
+		if tc.cfg.NegativeTTL > 0 {
+			if _, err := tc.cli.SETCtx(ctx, tc.prefix+key, negativeMarker, redis.SetWithPX(int(tc.cfg.NegativeTTL.Milliseconds()))); err != nil {
+				logrus.Errorf("[cache]tiered cache '%s' set negative '%s' err: %v.", tc.cfg.Name, key, err)
+			}
+			tc.setLocalNegative(key)
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tc.cli.SetObject(ctx, tc.prefix+key, v, redis.SetWithPX(int(tc.cfg.RedisTTL.Milliseconds()))); err != nil {
+		logrus.Errorf("[cache]tiered cache '%s' set '%s' to redis err: %v.", tc.cfg.Name, key, err)
+	}
+	_ = tc.local.Set(key, v)
+	return v, nil
+}
+
+// setLocalNegative 本地负缓存，过期时间不超过LocalTTL
+func (tc *TieredCache) setLocalNegative(key string) {
+	if tc.cfg.NegativeTTL <= 0 {
+		return
+	}
+	ttl := tc.cfg.NegativeTTL
+	if ttl > tc.cfg.LocalTTL {
+		ttl = tc.cfg.LocalTTL
+	}
+	_ = tc.local.SetWithExpire(key, negativeValue{}, ttl)
+}
+
+// Set 写入redis 及本地缓存，并广播失效消息
+func (tc *TieredCache) Set(ctx context.Context, key string, value interface{}) error {
+	if err := tc.cli.SetObject(ctx, tc.prefix+key, value, redis.SetWithPX(int(tc.cfg.RedisTTL.Milliseconds()))); err != nil {
+		return err
+	}
+	_ = tc.local.Set(key, value)
+	return tc.broadcast(ctx, key)
+}
+
+// Delete 删除redis 及本地缓存，并广播失效消息
+func (tc *TieredCache) Delete(ctx context.Context, key string) error {
+	if _, err := tc.cli.DELCtx(ctx, tc.prefix+key); err != nil {
+		return err
+	}
+	tc.local.Remove(key)
+	return tc.broadcast(ctx, key)
+}
+
+// broadcast 广播失效消息，格式为"实例id\nkey"
+func (tc *TieredCache) broadcast(ctx context.Context, key string) error {
+	_, err := tc.cli.PublishCtx(ctx, tc.channel, tc.instanceID+"\n"+key)
+	return err
+}
+
+// onInvalidate 收到失效消息时删除本地缓存（忽略本实例发出的消息）
+func (tc *TieredCache) onInvalidate(msg redis.PubSubMessage) {
+	parts := strings.SplitN(string(msg.Data), "\n", 2)
+	if len(parts) != 2 || parts[0] == tc.instanceID {
+		return
+	}
+	tc.local.Remove(parts[1])
+}
+
+// LocalStats 获取本地缓存统计
+func (tc *TieredCache) LocalStats() Stats {
+	return tc.local.Stats()
+}
+
+// Close 停止接收失效消息
+func (tc *TieredCache) Close() error {
+	return tc.sub.Close()
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/psoKnight/go-common/redis"
+)
+
+type tieredCacheUser struct {
+	Name string `json:"name" msgpack:"name"`
+}
+
+func TestTieredCache(t *testing.T) {
+
+	// 获取Redis
+	var cfg = &redis.RedisConfig{
+		Password:       "yZY0G0Dzh5N",
+		Address:        []string{"10.171.5.193:6382"},
+		DatabaseId:     0,
+		MaxIdle:        4,
+		MaxActive:      64,
+		IdleTimeout:    time.Duration(5000) * time.Millisecond,
+		ConnectTimeout: time.Duration(5000) * time.Millisecond,
+		ReadTimeout:    time.Duration(5000) * time.Millisecond,
+		WriteTimeout:   time.Duration(180) * time.Second,
+	}
+
+	redisClient, err := redis.NewRedis(cfg)
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	var loads int32
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return &tieredCacheUser{Name: key}, nil
+	}
+	newValue := func() interface{} { return &tieredCacheUser{} }
+
+	tc, err := NewTieredCache(&TieredCacheConfig{Name: "test_tiered_cache"}, redisClient, newValue, loader)
+	if err != nil {
+		t.Errorf("New tiered cache err: %v.", err)
+		return
+	}
+	defer tc.Close()
+
+	ctx := context.Background()
+	_ = tc.Delete(ctx, "user_1")
+	_ = tc.Delete(ctx, "missing")
+
+	// 第一次从loader 加载，之后命中本地缓存
+	for i := 0; i < 3; i++ {
+		v, err := tc.Get(ctx, "user_1")
+		if err != nil {
+			t.Errorf("Tiered cache get err: %v.", err)
+			return
+		}
+		if v.(*tieredCacheUser).Name != "user_1" {
+			t.Errorf("Tiered cache get unexpected value: %+v.", v)
+			return
+		}
+	}
+
+	// 负缓存
+	for i := 0; i < 3; i++ {
+		if _, err := tc.Get(ctx, "missing"); err != ErrNotFound {
+			t.Errorf("Tiered cache get missing err: %v.", err)
+			return
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Errorf("Tiered cache loads: %d.", n)
+		return
+	}
+
+	// 另一个实例从redis 读取，Set 后通过广播失效
+	other, err := NewTieredCache(&TieredCacheConfig{Name: "test_tiered_cache"}, redisClient, newValue, loader)
+	if err != nil {
+		t.Errorf("New tiered cache err: %v.", err)
+		return
+	}
+	defer other.Close()
+
+	if _, err := other.Get(ctx, "user_1"); err != nil {
+		t.Errorf("Tiered cache get err: %v.", err)
+		return
+	}
+	if err := tc.Set(ctx, "user_1", &tieredCacheUser{Name: "user_1_new"}); err != nil {
+		t.Errorf("Tiered cache set err: %v.", err)
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	v, err := other.Get(ctx, "user_1")
+	if err != nil {
+		t.Errorf("Tiered cache get err: %v.", err)
+		return
+	}
+	if v.(*tieredCacheUser).Name != "user_1_new" {
+		t.Errorf("Tiered cache get unexpected value after invalidation: %+v.", v)
+		return
+	}
+}
@@ -25,25 +25,54 @@ func (c *GrpcServerConf) Check() error {
 	return nil
 }
 
+// GrpcServerOption gRPC server 额外参数
+type GrpcServerOption func(o *grpcServerOptions)
+
+type grpcServerOptions struct {
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+}
+
+// GrpcServerWithUnaryInterceptor 追加unary 拦截器，按顺序在recover 之后执行
+func GrpcServerWithUnaryInterceptor(interceptors ...grpc.UnaryServerInterceptor) GrpcServerOption {
+	return func(o *grpcServerOptions) {
+		o.unaryInterceptors = append(o.unaryInterceptors, interceptors...)
+	}
+}
+
+// GrpcServerWithStreamInterceptor 追加stream 拦截器，按顺序在recover 之后执行
+func GrpcServerWithStreamInterceptor(interceptors ...grpc.StreamServerInterceptor) GrpcServerOption {
+	return func(o *grpcServerOptions) {
+		o.streamInterceptors = append(o.streamInterceptors, interceptors...)
+	}
+}
+
 type GrpcServer struct {
 	cfg        *GrpcServerConf // server配置
 	grpcServer *grpc.Server    // gRPC server 端
 }
 
 // NewGrpcServer 新建gRPC server
-func NewGrpcServer(cfg *GrpcServerConf) (*GrpcServer, error) {
+func NewGrpcServer(cfg *GrpcServerConf, options ...GrpcServerOption) (*GrpcServer, error) {
 	if err := cfg.Check(); err != nil {
 		return nil, err
 	}
 
+	o := &grpcServerOptions{}
+	for _, f := range options {
+		f(o)
+	}
+
 	var opts []grpc.ServerOption
 
 	// grpc-middleware
-	opts = append(opts, grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-		grpc_recovery.UnaryServerInterceptor(), //recover
+	opts = append(opts, grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(append(
+		[]grpc.UnaryServerInterceptor{grpc_recovery.UnaryServerInterceptor()}, //recover
+		o.unaryInterceptors...)...,
 	)))
-	opts = append(opts, grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
-		grpc_recovery.StreamServerInterceptor(), //recover
+	opts = append(opts, grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(append(
+		[]grpc.StreamServerInterceptor{grpc_recovery.StreamServerInterceptor()}, //recover
+		o.streamInterceptors...)...,
 	)))
 
 	//TODO auth, timeout
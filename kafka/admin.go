@@ -0,0 +1,327 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Shopify/sarama"
+)
+
+// TopicInfo topic 信息
+type TopicInfo struct {
+	Name       string
+	Internal   bool
+	Partitions []PartitionInfo
+	Configs    map[string]string // 非默认值的配置
+}
+
+// PartitionInfo 分区信息
+type PartitionInfo struct {
+	ID       int32
+	Leader   int32
+	Replicas []int32
+	Isr      []int32
+}
+
+// PartitionLag 分区的消费延迟
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	Committed int64 // 已提交的偏移，没有提交时为-1
+	HighWater int64 // 最新偏移（high-water mark）
+	Lag       int64 // HighWater - Committed，没有提交时按最早偏移计算
+}
+
+// GroupLag 消费组的消费延迟
+type GroupLag struct {
+	Group      string
+	Lag        int64 // 全部分区的延迟之和
+	Partitions []PartitionLag
+}
+
+// Admin 管理客户端
+/**
+各接口对Version 的要求：CreateTopic/DeleteTopic >= 0.10.1，DescribeTopics（配置）>= 0.11.0，AddPartitions >= 1.0.0；
+Config.Version 为空时sarama 按1.0.0 协商。
+*/
+type Admin struct {
+	cfg    *Config
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+}
+
+// NewAdmin 新建管理客户端
+func NewAdmin(cfg *Config) (*Admin, error) {
+	if cfg == nil {
+		return nil, errors.New("[kafka]config is nil")
+	}
+
+	sc, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(cfg.Endpoints, sc)
+	if err != nil {
+		return nil, err
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &Admin{cfg: cfg, client: client, admin: admin}, nil
+}
+
+// GetClusterAdmin 获取sarama ClusterAdmin
+func (a *Admin) GetClusterAdmin() sarama.ClusterAdmin {
+	return a.admin
+}
+
+// CreateTopic 创建topic，configs 为topic 配置（例如"retention.ms"），可以为nil
+func (a *Admin) CreateTopic(topic string, partitions int32, replicationFactor int16, configs map[string]string) error {
+	if topic == "" {
+		return errors.New("[kafka]topic is '', please check")
+	}
+	if partitions <= 0 || replicationFactor <= 0 {
+		return errors.New("[kafka]partitions and replication factor must be greater than 0")
+	}
+
+	detail := &sarama.TopicDetail{NumPartitions: partitions, ReplicationFactor: replicationFactor}
+	if len(configs) > 0 {
+		detail.ConfigEntries = make(map[string]*string, len(configs))
+		for k, v := range configs {
+			v := v
+			detail.ConfigEntries[k] = &v
+		}
+	}
+	return a.admin.CreateTopic(topic, detail, false)
+}
+
+// DeleteTopic 删除topic
+func (a *Admin) DeleteTopic(topic string) error {
+	if topic == "" {
+		return errors.New("[kafka]topic is '', please check")
+	}
+	return a.admin.DeleteTopic(topic)
+}
+
+// DescribeTopics 获取topic 的分区及配置，topics 为空时返回全部topic
+func (a *Admin) DescribeTopics(topics ...string) ([]*TopicInfo, error) {
+	if len(topics) == 0 {
+		all, err := a.admin.ListTopics()
+		if err != nil {
+			return nil, err
+		}
+		for topic := range all {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+	}
+
+	metadata, err := a.admin.DescribeTopics(topics)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*TopicInfo, 0, len(metadata))
+	for _, m := range metadata {
+		if m.Err != sarama.ErrNoError {
+			return nil, fmt.Errorf("[kafka]describe topic '%s' err: %w", m.Name, m.Err)
+		}
+
+		info := &TopicInfo{Name: m.Name, Internal: m.IsInternal, Configs: make(map[string]string)}
+		for _, p := range m.Partitions {
+			info.Partitions = append(info.Partitions, PartitionInfo{ID: p.ID, Leader: p.Leader, Replicas: p.Replicas, Isr: p.Isr})
+		}
+		sort.Slice(info.Partitions, func(i, j int) bool { return info.Partitions[i].ID < info.Partitions[j].ID })
+
+		entries, err := a.admin.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: m.Name})
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.Default && !e.Sensitive {
+				info.Configs[e.Name] = e.Value
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// AddPartitions 将topic 的分区数增加到count（分区总数）
+func (a *Admin) AddPartitions(topic string, count int32) error {
+	if topic == "" {
+		return errors.New("[kafka]topic is '', please check")
+	}
+	return a.admin.CreatePartitions(topic, count, nil, false)
+}
+
+// ListConsumerGroups 获取全部消费组
+func (a *Admin) ListConsumerGroups() ([]string, error) {
+	all, err := a.admin.ListConsumerGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, 0, len(all))
+	for group := range all {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// ConsumerLag 计算消费组每个分区的延迟
+/**
+topics 为空时计算消费组已提交偏移的全部分区（要求Version >= 0.10.2），否则计算指定topic 的全部分区；
+没有提交偏移的分区Committed 为-1，Lag 为最新偏移与最早偏移之差。
+*/
+func (a *Admin) ConsumerLag(group string, topics ...string) (*GroupLag, error) {
+	if group == "" {
+		return nil, errors.New("[kafka]group is '', please check")
+	}
+
+	var request map[string][]int32
+	if len(topics) > 0 {
+		request = make(map[string][]int32, len(topics))
+		for _, topic := range topics {
+			partitions, err := a.client.Partitions(topic)
+			if err != nil {
+				return nil, err
+			}
+			request[topic] = partitions
+		}
+	}
+
+	resp, err := a.admin.ListConsumerGroupOffsets(group, request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("[kafka]list group '%s' offsets err: %w", group, resp.Err)
+	}
+
+	committed := make(map[string]map[int32]int64)
+	for topic, blocks := range resp.Blocks {
+		for partition, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("[kafka]group '%s' topic '%s' partition %d offset err: %w", group, topic, partition, block.Err)
+			}
+			if committed[topic] == nil {
+				committed[topic] = make(map[int32]int64)
+			}
+			committed[topic][partition] = block.Offset
+		}
+	}
+	for topic, partitions := range request {
+		for _, partition := range partitions {
+			if _, ok := committed[topic][partition]; !ok {
+				if committed[topic] == nil {
+					committed[topic] = make(map[int32]int64)
+				}
+				committed[topic][partition] = -1
+			}
+		}
+	}
+
+	highWater, err := a.offsets(committed, sarama.OffsetNewest)
+	if err != nil {
+		return nil, err
+	}
+	uncommitted := make(map[string]map[int32]int64)
+	for topic, partitions := range committed {
+		for partition, offset := range partitions {
+			if offset < 0 {
+				if uncommitted[topic] == nil {
+					uncommitted[topic] = make(map[int32]int64)
+				}
+				uncommitted[topic][partition] = offset
+			}
+		}
+	}
+	oldest, err := a.offsets(uncommitted, sarama.OffsetOldest)
+	if err != nil {
+		return nil, err
+	}
+
+	gl := &GroupLag{Group: group}
+	for topic, partitions := range committed {
+		for partition, offset := range partitions {
+			hw := highWater[topic][partition]
+			lag := hw - offset
+			if offset < 0 {
+				lag = hw - oldest[topic][partition]
+			}
+			if lag < 0 {
+				lag = 0
+			}
+			gl.Partitions = append(gl.Partitions, PartitionLag{Topic: topic, Partition: partition, Committed: offset, HighWater: hw, Lag: lag})
+			gl.Lag += lag
+		}
+	}
+	sort.Slice(gl.Partitions, func(i, j int) bool {
+		if gl.Partitions[i].Topic != gl.Partitions[j].Topic {
+			return gl.Partitions[i].Topic < gl.Partitions[j].Topic
+		}
+		return gl.Partitions[i].Partition < gl.Partitions[j].Partition
+	})
+	return gl, nil
+}
+
+// offsets 按leader 批量获取分区的最新/最早偏移
+func (a *Admin) offsets(tps map[string]map[int32]int64, position int64) (map[string]map[int32]int64, error) {
+	requests := make(map[*sarama.Broker]*sarama.OffsetRequest)
+	for topic, partitions := range tps {
+		for partition := range partitions {
+			leader, err := a.client.Leader(topic, partition)
+			if err != nil {
+				return nil, err
+			}
+			req, ok := requests[leader]
+			if !ok {
+				req = &sarama.OffsetRequest{}
+				if a.client.Config().Version.IsAtLeast(sarama.V0_10_1_0) {
+					req.Version = 1
+				}
+				requests[leader] = req
+			}
+			req.AddBlock(topic, partition, position, 1)
+		}
+	}
+
+	result := make(map[string]map[int32]int64)
+	for broker, req := range requests {
+		resp, err := broker.GetAvailableOffsets(req)
+		if err != nil {
+			return nil, err
+		}
+		for topic, partitions := range tps {
+			for partition := range partitions {
+				block := resp.GetBlock(topic, partition)
+				if block == nil {
+					// 不在该broker 的请求中
+					continue
+				}
+				if block.Err != sarama.ErrNoError {
+					return nil, fmt.Errorf("[kafka]topic '%s' partition %d get offset err: %w", topic, partition, block.Err)
+				}
+				offset := block.Offset
+				if req.Version == 0 && len(block.Offsets) > 0 {
+					offset = block.Offsets[0]
+				}
+				if result[topic] == nil {
+					result[topic] = make(map[int32]int64)
+				}
+				result[topic][partition] = offset
+			}
+		}
+	}
+	return result, nil
+}
+
+// Close 关闭管理客户端
+func (a *Admin) Close() error {
+	return a.admin.Close()
+}
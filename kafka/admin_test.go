@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestAdminConsumerLag(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("test", 0, broker.BrokerID()).
+			SetLeader("test", 1, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("group", "test", 0, 10, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("test", 0, sarama.OffsetNewest, 15).
+			SetOffset("test", 1, sarama.OffsetNewest, 7).
+			SetOffset("test", 1, sarama.OffsetOldest, 2),
+	})
+
+	admin, err := NewAdmin(&Config{Endpoints: []string{broker.Addr()}})
+	if err != nil {
+		t.Errorf("new admin err: %v.", err)
+		return
+	}
+	defer admin.Close()
+
+	gl, err := admin.ConsumerLag("group", "test")
+	if err != nil {
+		t.Errorf("consumer lag err: %v.", err)
+		return
+	}
+	want := []PartitionLag{
+		{Topic: "test", Partition: 0, Committed: 10, HighWater: 15, Lag: 5},
+		{Topic: "test", Partition: 1, Committed: -1, HighWater: 7, Lag: 5},
+	}
+	if gl.Lag != 10 || len(gl.Partitions) != len(want) {
+		t.Errorf("group lag: %d, partitions: %v.", gl.Lag, gl.Partitions)
+		return
+	}
+	for i, pl := range gl.Partitions {
+		if pl != want[i] {
+			t.Errorf("partition lag: %+v, want: %+v.", pl, want[i])
+			return
+		}
+	}
+
+	if err := admin.CreateTopic("test", 0, 1, nil); err == nil {
+		t.Errorf("create topic with 0 partitions should fail.")
+		return
+	}
+}
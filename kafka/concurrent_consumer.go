@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// GroupConsumerWithConcurrency 开启分区内并发处理
+/**
+每个分区启动workers 个协程，消息按key 的hash 分配，相同key 的消息在同一个协程中按顺序处理（key 为空的消息不保证顺序）；
+每个分区最多有maxInFlight 条消息正在处理（<=0 时为workers*16），偏移只有在之前的消息全部处理完成后才会提交。
+*/
+func GroupConsumerWithConcurrency(workers, maxInFlight int) GroupConsumerOption {
+	return func(g *GroupConsumer) {
+		g.workers = workers
+		g.maxInFlight = maxInFlight
+	}
+}
+
+// consumeConcurrently 分区内按key 并发处理
+func (g *GroupConsumer) consumeConcurrently(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := sess.Context()
+	maxInFlight := g.maxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = g.workers * 16
+	}
+
+	tracker := &offsetTracker{done: make(map[int64]bool)}
+	inFlight := make(chan struct{}, maxInFlight)
+	queues := make([]chan *sarama.ConsumerMessage, g.workers)
+
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan *sarama.ConsumerMessage, maxInFlight)
+		wg.Add(1)
+		go func(queue chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for msg := range queue {
+				// session 结束后不再处理，也不标记
+				if ctx.Err() == nil && g.process(ctx, msg) {
+					if next, ok := tracker.complete(msg.Offset); ok {
+						// MarkOffset 只会增大偏移，并发调用的先后不影响结果
+						sess.MarkOffset(msg.Topic, msg.Partition, next, "")
+					}
+				}
+				<-inFlight
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+			tracker.add(msg.Offset)
+			queues[workerIndex(msg, g.workers)] <- msg
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// workerIndex 根据key 选择协程，key 为空时按偏移分配
+func workerIndex(msg *sarama.ConsumerMessage, workers int) int {
+	if len(msg.Key) == 0 {
+		return int(msg.Offset % int64(workers))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(msg.Key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// offsetTracker 记录分区内已分配的偏移，只有连续完成的偏移才可以提交
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending []int64 // 按顺序分配的偏移
+	done    map[int64]bool
+}
+
+// add 分配偏移
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	t.pending = append(t.pending, offset)
+	t.mu.Unlock()
+}
+
+// complete 标记偏移完成，返回可以提交的下一个偏移（之前的消息全部完成）
+func (t *offsetTracker) complete(offset int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+	next, ok := int64(0), false
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		delete(t.done, t.pending[0])
+		next, ok = t.pending[0]+1, true
+		t.pending = t.pending[1:]
+	}
+	return next, ok
+}
@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// testSession 只实现测试用到的方法
+type testSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	mu     sync.Mutex
+	offset int64
+}
+
+func (s *testSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offset > s.offset {
+		s.offset = offset
+	}
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func TestConsumeConcurrently(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string][]int64)
+	)
+	g := &GroupConsumer{
+		group: "test_group",
+		handler: func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			if msg.Offset == 0 {
+				// 第一条消息最后完成，之前不能提交任何偏移
+				time.Sleep(50 * time.Millisecond)
+			}
+			mu.Lock()
+			seen[string(msg.Key)] = append(seen[string(msg.Key)], msg.Offset)
+			mu.Unlock()
+			return nil
+		},
+		workers:     4,
+		maxInFlight: 8,
+		errors:      make(chan error, 1),
+	}
+
+	sess := &testSession{ctx: context.Background()}
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = g.ConsumeClaim(sess, claim)
+	}()
+
+	for i := 0; i < 20; i++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "test", Key: []byte("key_" + strconv.Itoa(i%5)), Offset: int64(i)}
+	}
+	time.Sleep(10 * time.Millisecond)
+	sess.mu.Lock()
+	if sess.offset != 0 {
+		t.Errorf("Offset committed before earlier message finished: %d.", sess.offset)
+	}
+	sess.mu.Unlock()
+
+	close(claim.messages)
+	<-done
+
+	if sess.offset != 20 {
+		t.Errorf("Committed offset unexpected: %d.", sess.offset)
+		return
+	}
+	for key, offsets := range seen {
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Errorf("Key '%s' processed out of order: %v.", key, offsets)
+				return
+			}
+		}
+	}
+}
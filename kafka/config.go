@@ -0,0 +1,204 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	SASLPlain       = sarama.SASLTypePlaintext   // "PLAIN"
+	SASLScramSHA256 = sarama.SASLTypeSCRAMSHA256 // "SCRAM-SHA-256"
+	SASLScramSHA512 = sarama.SASLTypeSCRAMSHA512 // "SCRAM-SHA-512"
+)
+
+const (
+	PartitionerHash       = "hash"        // 根据key 的hash 选择分区（key 为空时随机）
+	PartitionerRandom     = "random"      // 随机分区
+	PartitionerRoundRobin = "round_robin" // 轮询分区
+	PartitionerManual     = "manual"      // 使用消息中指定的分区
+)
+
+const (
+	AcksNone   = "none"   // 不等待broker 确认
+	AcksLeader = "leader" // 等待leader 写入
+	AcksAll    = "all"    // 等待全部ISR 写入
+)
+
+// Config 通用对象
+type Config struct {
+	Endpoints []string
+	Version   string // kafka 版本，例如"2.8.0"，为空时使用sarama 默认版本；低于0.10.0 时消息中的timestamp 没有作用
+	ClientID  string // 客户端id，为空时使用sarama 默认值
+
+	ReadCommitted bool // 消费时只读取已提交事务的消息（isolation.level=read_committed），要求Version >= 0.11.0
+
+	SASL     SASLConfig
+	TLS      TLSConfig
+	Producer ProducerConfig
+}
+
+// SASLConfig SASL 认证配置
+type SASLConfig struct {
+	Enable    bool
+	Mechanism string // 参考SASL* 常量，默认PLAIN
+	User      string
+	Password  string
+}
+
+// TLSConfig TLS 配置
+type TLSConfig struct {
+	Enable             bool
+	CAFile             string // CA 证书，为空时使用系统证书
+	CertFile           string // 客户端证书，与KeyFile 同时设置时开启双向认证
+	KeyFile            string
+	InsecureSkipVerify bool // 跳过服务端证书校验
+}
+
+// ProducerConfig 生产者配置
+type ProducerConfig struct {
+	RequiredAcks    string        // 参考Acks* 常量，默认all
+	Partitioner     string        // 参考Partitioner* 常量，默认random
+	Compression     string        // none/gzip/snappy/lz4/zstd，默认none
+	Idempotent      bool          // 幂等生产者，要求Version >= 0.11.0，会强制acks=all 及单连接单请求
+	MaxMessageBytes int           // 单条消息最大字节数，默认1000000
+	RetryMax        int           // 发送失败重试次数，默认3
+	FlushBytes      int           // 批量发送的字节数阈值
+	FlushMessages   int           // 批量发送的消息数阈值
+	FlushFrequency  time.Duration // 批量发送的最长等待时间（linger）
+	TransactionalID string        // 事务id（transactional.id），NewTxnProducer 使用
+}
+
+// saramaConfig 根据Config 生成sarama 配置
+func (cfg *Config) saramaConfig() (*sarama.Config, error) {
+	sc := sarama.NewConfig()
+
+	if cfg.Version != "" {
+		version, err := sarama.ParseKafkaVersion(cfg.Version)
+		if err != nil {
+			return nil, fmt.Errorf("[kafka]parse version '%s' err: %v", cfg.Version, err)
+		}
+		sc.Version = version
+	}
+	if cfg.ClientID != "" {
+		sc.ClientID = cfg.ClientID
+	}
+	if cfg.ReadCommitted {
+		sc.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
+
+	if cfg.SASL.Enable {
+		sc.Net.SASL.Enable = true
+		sc.Net.SASL.User = cfg.SASL.User
+		sc.Net.SASL.Password = cfg.SASL.Password
+		switch cfg.SASL.Mechanism {
+		case "", SASLPlain:
+			sc.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case SASLScramSHA256, SASLScramSHA512:
+			sc.Net.SASL.Mechanism = sarama.SASLMechanism(cfg.SASL.Mechanism)
+			sc.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMClientGenerator(sc.Net.SASL.Mechanism)
+		default:
+			return nil, fmt.Errorf("[kafka]unknown sasl mechanism '%s'", cfg.SASL.Mechanism)
+		}
+	}
+
+	if cfg.TLS.Enable {
+		tlsConfig, err := cfg.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		sc.Net.TLS.Enable = true
+		sc.Net.TLS.Config = tlsConfig
+	}
+
+	if err := cfg.Producer.apply(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// tlsConfig 加载证书
+func (t *TLSConfig) tlsConfig() (*tls.Config, error) {
+	tc := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("[kafka]invalid ca file '%s'", t.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, errors.New("[kafka]tls cert file and key file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// apply 设置生产者相关配置
+func (p *ProducerConfig) apply(sc *sarama.Config) error {
+	switch p.RequiredAcks {
+	case "", AcksAll:
+		sc.Producer.RequiredAcks = sarama.WaitForAll
+	case AcksLeader:
+		sc.Producer.RequiredAcks = sarama.WaitForLocal
+	case AcksNone:
+		sc.Producer.RequiredAcks = sarama.NoResponse
+	default:
+		return fmt.Errorf("[kafka]unknown required acks '%s'", p.RequiredAcks)
+	}
+
+	switch p.Partitioner {
+	case "", PartitionerRandom:
+		sc.Producer.Partitioner = sarama.NewRandomPartitioner
+	case PartitionerHash:
+		sc.Producer.Partitioner = sarama.NewHashPartitioner
+	case PartitionerRoundRobin:
+		sc.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	case PartitionerManual:
+		sc.Producer.Partitioner = sarama.NewManualPartitioner
+	default:
+		return fmt.Errorf("[kafka]unknown partitioner '%s'", p.Partitioner)
+	}
+
+	if p.Compression != "" {
+		if err := sc.Producer.Compression.UnmarshalText([]byte(p.Compression)); err != nil {
+			return fmt.Errorf("[kafka]unknown compression '%s'", p.Compression)
+		}
+	}
+
+	if p.MaxMessageBytes > 0 {
+		sc.Producer.MaxMessageBytes = p.MaxMessageBytes
+	}
+	if p.RetryMax > 0 {
+		sc.Producer.Retry.Max = p.RetryMax
+	}
+	sc.Producer.Flush.Bytes = p.FlushBytes
+	sc.Producer.Flush.Messages = p.FlushMessages
+	sc.Producer.Flush.Frequency = p.FlushFrequency
+
+	if p.Idempotent {
+		if p.RequiredAcks != "" && p.RequiredAcks != AcksAll {
+			return errors.New("[kafka]idempotent producer requires acks 'all'")
+		}
+		sc.Producer.Idempotent = true
+		sc.Net.MaxOpenRequests = 1
+	}
+	return nil
+}
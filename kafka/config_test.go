@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestSaramaConfig(t *testing.T) {
+	cfg := &Config{
+		Endpoints: []string{"127.0.0.1:9092"},
+		Version:   "2.8.0",
+		ClientID:  "go-common",
+		SASL:      SASLConfig{Enable: true, Mechanism: SASLScramSHA512, User: "user", Password: "pencil"},
+		Producer: ProducerConfig{
+			Partitioner: PartitionerHash,
+			Compression: "zstd",
+			Idempotent:  true,
+		},
+	}
+
+	sc, err := cfg.saramaConfig()
+	if err != nil {
+		t.Errorf("Sarama config err: %v.", err)
+		return
+	}
+	if err := sc.Validate(); err != nil {
+		t.Errorf("Sarama config validate err: %v.", err)
+		return
+	}
+	if sc.Version != sarama.V2_8_0_0 || sc.Producer.Compression != sarama.CompressionZSTD || sc.Net.SASL.SCRAMClientGeneratorFunc == nil {
+		t.Errorf("Sarama config unexpected: %+v.", sc)
+		return
+	}
+
+	cfg.Producer.RequiredAcks = AcksLeader
+	if _, err := cfg.saramaConfig(); err == nil {
+		t.Errorf("Idempotent producer with acks 'leader' should return err.")
+		return
+	}
+}
+
+func TestSCRAMClient(t *testing.T) {
+	// RFC 7677 测试用例
+	c := newSCRAMClientGenerator(sarama.SASLTypeSCRAMSHA256)().(*scramClient)
+	if err := c.Begin("user", "pencil", ""); err != nil {
+		t.Errorf("Scram begin err: %v.", err)
+		return
+	}
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	msg, err := c.Step("")
+	if err != nil || msg != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Errorf("Scram client first unexpected: %s, %v.", msg, err)
+		return
+	}
+	msg, err = c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if err != nil || msg != "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=" {
+		t.Errorf("Scram client final unexpected: %s, %v.", msg, err)
+		return
+	}
+	if _, err := c.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil || !c.Done() {
+		t.Errorf("Scram verify server signature err: %v.", err)
+		return
+	}
+}
@@ -21,12 +21,12 @@ func NewConsumer(cfg *Config) (*Consumer, error) {
 	}
 
 	// 消费者配置
-	consumConfig := sarama.NewConfig()
+	consumConfig, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 	consumConfig.Consumer.Return.Errors = true
 	consumConfig.Consumer.Offsets.AutoCommit.Enable = false // 取消自动指定提交消息
-	// 设置使用的kafka版本,如果低于V0_10_0_0版本,消息中的timestrap 没有作用。需要消费和生产同时配置
-	// 注意，版本设置不对的话，kafka 会返回很奇怪的错误，并且无法成功发送消息
-	//consumConfig.Version = sarama.V0_10_2_1
 
 	consumer, err := sarama.NewConsumer(cfg.Endpoints, consumConfig)
 	if err != nil {
@@ -71,8 +71,8 @@ func (c *Consumer) ConsumeMessage(topic, key string, offsetType int64, ch chan *
 	logrus.Infof("[kafka]topic '%s' all partitions: %v.", topic, partitions)
 
 	// 循环分区
-	for partition := range partitions {
-		pc, err := c.Consumer.ConsumePartition(topic, int32(partition), offsetType)
+	for _, partition := range partitions {
+		pc, err := c.Consumer.ConsumePartition(topic, partition, offsetType)
 		if err != nil {
 			logrus.Infof("[kafka]topic '%s' consume partition '%d' err: %v, continue.", topic, partition, err)
 			continue
@@ -92,6 +92,8 @@ func (c *Consumer) ConsumeMessage(topic, key string, offsetType int64, ch chan *
 
 // ConsumeMessageByGroup 消费者消费数据(通过消费组)
 /**
+只调用一次Consume（rebalance 后返回），需要自行提交偏移，推荐使用GroupConsumer。
+
 offsetType
 	-1：OffsetNewest 代表日志头偏移量，即将分配给将要生成到分区的下一条消息的偏移量
 	-2：OffsetOldest 代表代理上可用于分区的最旧偏移量
@@ -102,10 +104,12 @@ func (c *Consumer) ConsumeMessageByGroup(topics []string, group string, offsetTy
 	}
 
 	// 消费者配置
-	consumConfig := sarama.NewConfig()
+	consumConfig, err := c.cfg.saramaConfig()
+	if err != nil {
+		return err
+	}
 	consumConfig.Consumer.Return.Errors = true
 	consumConfig.Consumer.Offsets.AutoCommit.Enable = false // 取消自动指定提交消息
-	//consuConfig.Version = sarama.V0_10_2_1
 
 	// 获取偏移方式
 	if offsetType == -1 {
@@ -119,7 +123,7 @@ func (c *Consumer) ConsumeMessageByGroup(topics []string, group string, offsetTy
 
 	gr, err := sarama.NewConsumerGroup(c.cfg.Endpoints, group, consumConfig)
 	if err != nil {
-		return nil
+		return err
 	}
 	defer gr.Close()
 
@@ -0,0 +1,362 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// MessageHandler 消息处理函数，返回错误时按配置重试
+type MessageHandler func(ctx context.Context, msg *sarama.ConsumerMessage) error
+
+// GroupConsumerOption GroupConsumer 额外参数
+type GroupConsumerOption func(g *GroupConsumer)
+
+// GroupConsumerWithOffsetInitial 设置没有已提交偏移时的初始偏移，-1：OffsetNewest（默认），-2：OffsetOldest
+func GroupConsumerWithOffsetInitial(offset int64) GroupConsumerOption {
+	return func(g *GroupConsumer) {
+		g.offsetInitial = offset
+	}
+}
+
+// GroupConsumerWithRetry 设置处理失败时的重试次数及退避时间（每次翻倍，不超过maxBackoff），默认重试3 次，100ms ~ 5s；max < 0 表示一直重试
+func GroupConsumerWithRetry(max int, backoff, maxBackoff time.Duration) GroupConsumerOption {
+	return func(g *GroupConsumer) {
+		g.retryMax = max
+		g.backoff = backoff
+		g.maxBackoff = maxBackoff
+	}
+}
+
+// GroupConsumerWithCommitInterval 设置提交偏移的间隔，默认1s
+func GroupConsumerWithCommitInterval(interval time.Duration) GroupConsumerOption {
+	return func(g *GroupConsumer) {
+		g.commitInterval = interval
+	}
+}
+
+// GroupConsumerWithErrorsSize 设置错误通道的缓冲大小，默认64，通道满时丢弃错误（记录日志）
+func GroupConsumerWithErrorsSize(size int) GroupConsumerOption {
+	return func(g *GroupConsumer) {
+		g.errorsSize = size
+	}
+}
+
+// GroupConsumer 消费组消费者
+/**
+1. 每次rebalance 后重新进入Consume，直到ctx 被取消或Close；
+2. 消息处理成功后标记偏移，按间隔提交，rebalance 前提交一次；
+3. 处理失败时按退避时间重试，重试次数耗尽后将错误发送到Errors() 并跳过该消息（开启重试topic 时转发到重试/死信topic）；
+4. ctx 被取消时等待正在处理的消息返回后退出（未处理成功的消息不会提交）；
+5. 处理返回ErrTxnFenced 时停止消费，Run 返回该错误；
+6. Run 返回后消费组及Errors() 已关闭，只能Run 一次，重新消费需要新建GroupConsumer。
+*/
+type GroupConsumer struct {
+	cfg     *Config
+	group   string
+	topics  []string
+	handler MessageHandler
+	cg      sarama.ConsumerGroup
+
+	offsetInitial  int64
+	retryMax       int
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	commitInterval time.Duration
+	errorsSize     int
+
+	workers     int // 每个分区的并发数
+	maxInFlight int // 每个分区正在处理的最大消息数
+
+	retryTopics bool
+	retryDelays []time.Duration
+	topicLevels map[string]int // 重试topic 对应的级别
+	producer    sarama.SyncProducer
+
+	txn *TxnProducer // NewTransactionalConsumer 使用的事务生产者，偏移只通过事务提交
+
+	mu     sync.Mutex
+	ran    bool               // 是否已调用Run
+	cancel context.CancelFunc // 取消Run
+	fatal  error              // 导致停止消费的错误
+
+	errors    chan error
+	closeOnce sync.Once
+}
+
+// NewGroupConsumer 新建消费组消费者
+func NewGroupConsumer(cfg *Config, group string, topics []string, handler MessageHandler, options ...GroupConsumerOption) (*GroupConsumer, error) {
+	if cfg == nil {
+		return nil, errors.New("[kafka]config is nil")
+	}
+	if group == "" || len(topics) == 0 {
+		return nil, errors.New("[kafka]group is '' or len topic is 0, please check")
+	}
+	if handler == nil {
+		return nil, errors.New("[kafka]handler is nil")
+	}
+
+	g := &GroupConsumer{
+		cfg:            cfg,
+		group:          group,
+		topics:         topics,
+		handler:        handler,
+		offsetInitial:  sarama.OffsetNewest,
+		retryMax:       3,
+		backoff:        100 * time.Millisecond,
+		maxBackoff:     5 * time.Second,
+		commitInterval: time.Second,
+		errorsSize:     64,
+	}
+	for _, f := range options {
+		f(g)
+	}
+	if g.offsetInitial != sarama.OffsetOldest {
+		g.offsetInitial = sarama.OffsetNewest
+	}
+	g.errors = make(chan error, g.errorsSize)
+
+	consumConfig, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	consumConfig.Consumer.Return.Errors = true
+	consumConfig.Consumer.Offsets.Initial = g.offsetInitial
+	consumConfig.Consumer.Offsets.AutoCommit.Enable = g.txn == nil // 只提交已标记的偏移，事务消费者的偏移由事务提交
+	consumConfig.Consumer.Offsets.AutoCommit.Interval = g.commitInterval
+
+	if err := g.initRetryTopics(); err != nil {
+		return nil, err
+	}
+
+	cg, err := sarama.NewConsumerGroup(cfg.Endpoints, group, consumConfig)
+	if err != nil {
+		if g.producer != nil {
+			_ = g.producer.Close()
+		}
+		return nil, err
+	}
+	g.cg = cg
+	return g, nil
+}
+
+// Errors 错误通道（消费组错误及重试耗尽的处理错误），Run 返回后关闭
+func (g *GroupConsumer) Errors() <-chan error {
+	return g.errors
+}
+
+// Run 开始消费，阻塞直到ctx 被取消或Close，返回前关闭消费组及Errors()
+/**
+因ErrTxnFenced 停止消费时返回该错误，否则返回nil；只能调用一次，再次调用返回错误。
+*/
+func (g *GroupConsumer) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	g.mu.Lock()
+	if g.ran {
+		g.mu.Unlock()
+		return errors.New("[kafka]group consumer can only run once")
+	}
+	g.ran = true
+	g.cancel = cancel
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(done)
+		wg.Wait()
+		_ = g.Close()
+		close(g.errors)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case err, ok := <-g.cg.Errors():
+				if !ok {
+					return
+				}
+				g.report(err)
+			}
+		}
+	}()
+
+	backoff := g.backoff
+	for {
+		err := g.cg.Consume(ctx, g.topics, g)
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) || ctx.Err() != nil {
+			return g.fatalErr()
+		}
+		if err == nil {
+			// rebalance 后重新加入
+			backoff = g.backoff
+			continue
+		}
+
+		g.report(err)
+		if !sleepContext(ctx, backoff) {
+			return g.fatalErr()
+		}
+		backoff = g.nextBackoff(backoff)
+	}
+}
+
+// stop 因不可恢复的错误停止消费
+func (g *GroupConsumer) stop(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.fatal == nil {
+		g.fatal = err
+		logrus.Errorf("[kafka]group '%s' stop consuming, err: %v.", g.group, err)
+	}
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
+
+// fatalErr 获取导致停止消费的错误
+func (g *GroupConsumer) fatalErr() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.fatal
+}
+
+// Close 关闭消费组，正在进行的Run 会返回
+func (g *GroupConsumer) Close() error {
+	var err error
+	g.closeOnce.Do(func() {
+		err = g.cg.Close()
+		if g.producer != nil {
+			_ = g.producer.Close()
+		}
+		if g.txn != nil {
+			_ = g.txn.Close()
+		}
+	})
+	return err
+}
+
+// Setup 实现sarama.ConsumerGroupHandler 接口
+func (g *GroupConsumer) Setup(sess sarama.ConsumerGroupSession) error {
+	logrus.Infof("[kafka]group '%s' claims: %v.", g.group, sess.Claims())
+	return nil
+}
+
+// Cleanup 实现sarama.ConsumerGroupHandler 接口，rebalance 前提交已标记的偏移
+func (g *GroupConsumer) Cleanup(sess sarama.ConsumerGroupSession) error {
+	sess.Commit()
+	return nil
+}
+
+// ConsumeClaim 实现sarama.ConsumerGroupHandler 接口
+func (g *GroupConsumer) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if g.workers > 1 {
+		return g.consumeConcurrently(sess, claim)
+	}
+
+	ctx := sess.Context()
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !g.process(ctx, msg) {
+				// session 结束，不标记该消息
+				return nil
+			}
+			if g.txn == nil {
+				sess.MarkMessage(msg, "")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// process 处理消息（重试topic 中的消息先等待到重试时间），返回false 表示session 已结束、消息未处理完成
+func (g *GroupConsumer) process(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	if !g.waitRetry(ctx, msg) {
+		return false
+	}
+	return g.handle(ctx, msg) == nil
+}
+
+// handle 处理消息并重试，只有ctx 被取消或者生产者被fence 时返回错误
+func (g *GroupConsumer) handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	backoff := g.backoff
+	for attempt := 0; ; attempt++ {
+		err := g.handler(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, ErrTxnFenced) {
+			// 重试不会成功，停止消费且不标记该消息
+			g.stop(err)
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if g.retryMax >= 0 && attempt >= g.retryMax {
+			if g.producer != nil {
+				return g.forward(ctx, msg, err)
+			}
+			g.report(fmt.Errorf("[kafka]group '%s' handle message topic '%s' partition %d offset %d err: %w",
+				g.group, msg.Topic, msg.Partition, msg.Offset, err))
+			return nil
+		}
+
+		logrus.Warnf("[kafka]group '%s' handle message topic '%s' partition %d offset %d err: %v, retry after %v.",
+			g.group, msg.Topic, msg.Partition, msg.Offset, err, backoff)
+		if !sleepContext(ctx, backoff) {
+			return ctx.Err()
+		}
+		backoff = g.nextBackoff(backoff)
+	}
+}
+
+// nextBackoff 退避时间翻倍
+func (g *GroupConsumer) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if g.maxBackoff > 0 && backoff > g.maxBackoff {
+		backoff = g.maxBackoff
+	}
+	return backoff
+}
+
+// report 发送错误到错误通道，通道满时丢弃
+func (g *GroupConsumer) report(err error) {
+	select {
+	case g.errors <- err:
+	default:
+		logrus.Errorf("[kafka]group '%s' errors channel is full, drop err: %v.", g.group, err)
+	}
+}
+
+// sleepContext 等待d，ctx 被取消时返回false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
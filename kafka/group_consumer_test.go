@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/psoKnight/go-common/kafka/kafkatest"
+)
+
+func TestGroupConsumerHandle(t *testing.T) {
+	attempts := 0
+	g := &GroupConsumer{
+		group: "test_group",
+		handler: func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("temporary err")
+			}
+			return nil
+		},
+		retryMax:   3,
+		backoff:    time.Millisecond,
+		maxBackoff: 4 * time.Millisecond,
+		errors:     make(chan error, 1),
+	}
+
+	msg := &sarama.ConsumerMessage{Topic: "test", Partition: 0, Offset: 1}
+	if err := g.handle(context.Background(), msg); err != nil || attempts != 3 {
+		t.Errorf("Handle with retry unexpected: %v, attempts %d.", err, attempts)
+		return
+	}
+
+	// 重试耗尽后跳过并发送错误
+	attempts = -10
+	if err := g.handle(context.Background(), msg); err != nil || attempts != -6 {
+		t.Errorf("Handle retry exhausted unexpected: %v, attempts %d.", err, attempts)
+		return
+	}
+	select {
+	case err := <-g.Errors():
+		t.Logf("Handle err: %v.", err)
+	default:
+		t.Errorf("Retry exhausted should report err.")
+		return
+	}
+
+	// ctx 被取消时返回错误（不标记消息）
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = -10
+	if err := g.handle(ctx, msg); err == nil {
+		t.Errorf("Handle with canceled ctx should return err.")
+		return
+	}
+}
+
+func TestGroupConsumerRun(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.Seed("test", 0, kafkatest.Record{Key: []byte("k1"), Value: []byte("a")}, kafkatest.Record{Key: []byte("k2"), Value: []byte("b")})
+	cluster.Seed("test", 1, kafkatest.Record{Key: []byte("k3"), Value: []byte("c"), Headers: map[string]string{"h": "v"}})
+	cluster.AddGroup("test_group", "test")
+
+	var mu sync.Mutex
+	got := make(map[string]string)
+	done := make(chan struct{})
+	handler := func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got[string(msg.Key)] = string(msg.Value) + recordHeader(msg.Headers, "h")
+		if len(got) == 3 {
+			close(done)
+		}
+		return nil
+	}
+
+	g, err := NewGroupConsumer(&Config{Endpoints: cluster.Endpoints()}, "test_group", []string{"test"}, handler,
+		GroupConsumerWithOffsetInitial(sarama.OffsetOldest))
+	if err != nil {
+		t.Errorf("New group consumer err: %v.", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- g.Run(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Group consumer timeout, got: %v.", got)
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Errorf("Group consumer run err: %v.", err)
+		return
+	}
+
+	if got["k1"] != "a" || got["k2"] != "b" || got["k3"] != "cv" {
+		t.Errorf("Group consumer got: %v.", got)
+		return
+	}
+	if c0, c1 := cluster.Committed("test_group", "test", 0), cluster.Committed("test_group", "test", 1); c0 != 2 || c1 != 1 {
+		t.Errorf("Group consumer committed: %d, %d, want 2, 1.", c0, c1)
+		return
+	}
+
+	// 只能Run 一次
+	if err := g.Run(context.Background()); err == nil {
+		t.Errorf("Group consumer run twice should return err.")
+		return
+	}
+}
@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"context"
 	"errors"
 	"github.com/Shopify/sarama"
 	"time"
@@ -13,11 +14,6 @@ type Kafka struct {
 	cfg      *Config
 }
 
-// Config 通用对象
-type Config struct {
-	Endpoints []string
-}
-
 func NewKafka(cfg *Config) (*Kafka, error) {
 
 	if cfg == nil {
@@ -48,6 +44,9 @@ func (k *Kafka) GetSyncProducer() sarama.SyncProducer {
 }
 
 // GetAsyncProducer 获取Kafka AsyncProducer
+/**
+Successes()/Errors() 由Producer 的后台协程读取，不能直接读取，否则会拿走Send 的确认。
+*/
 func (k *Kafka) GetAsyncProducer() sarama.AsyncProducer {
 	return k.producer.AsyncProducer
 }
@@ -67,6 +66,31 @@ func (k *Kafka) AsyncSendMessage(topic, key, value string, timeOut time.Duration
 	return k.producer.AsyncSendMessage(topic, key, value, timeOut)
 }
 
+// SyncSend 同步发送消息
+func (k *Kafka) SyncSend(msg *Message) (int32, int64, error) {
+	return k.producer.SyncSend(msg)
+}
+
+// SendObject 序列化value 后同步发送
+func (k *Kafka) SendObject(topic, key string, value interface{}, serializer Serializer) (int32, int64, error) {
+	return k.producer.SendObject(topic, key, value, serializer)
+}
+
+// Send 异步发送消息，发送结果通过callback 返回
+func (k *Kafka) Send(msg *sarama.ProducerMessage, callback SendCallback) error {
+	return k.producer.Send(msg, callback)
+}
+
+// Flush 等待已经Send 的消息全部确认
+func (k *Kafka) Flush(ctx context.Context) error {
+	return k.producer.Flush(ctx)
+}
+
+// SendMessages 同步批量发送消息
+func (k *Kafka) SendMessages(msgs []*sarama.ProducerMessage) error {
+	return k.producer.SendMessages(msgs)
+}
+
 // ConsumeMessage 消费数据
 func (k *Kafka) ConsumeMessage(topic, key string, offsetType int64, ch chan *sarama.ConsumerMessage) error {
 	return k.consumer.ConsumeMessage(topic, key, offsetType, ch)
@@ -77,6 +101,26 @@ func (k *Kafka) ConsumeMessageByGroup(topics []string, group string, offsetType
 	return k.consumer.ConsumeMessageByGroup(topics, group, offsetType, handler)
 }
 
+// NewGroupConsumer 新建消费组消费者
+func (k *Kafka) NewGroupConsumer(group string, topics []string, handler MessageHandler, options ...GroupConsumerOption) (*GroupConsumer, error) {
+	return NewGroupConsumer(k.cfg, group, topics, handler, options...)
+}
+
+// NewTxnProducer 新建事务生产者
+func (k *Kafka) NewTxnProducer() (*TxnProducer, error) {
+	return NewTxnProducer(k.cfg)
+}
+
+// NewTransactionalConsumer 新建consume-transform-produce 消费者
+func (k *Kafka) NewTransactionalConsumer(group string, topics []string, transform TransformFunc, options ...GroupConsumerOption) (*GroupConsumer, error) {
+	return NewTransactionalConsumer(k.cfg, group, topics, transform, options...)
+}
+
+// NewAdmin 新建管理客户端
+func (k *Kafka) NewAdmin() (*Admin, error) {
+	return NewAdmin(k.cfg)
+}
+
 // Close 关闭kafka
 func (k *Kafka) Close() error {
 	_ = k.producer.Close()
@@ -3,27 +3,27 @@ package kafka
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/Shopify/sarama"
 	"testing"
 	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/psoKnight/go-common/kafka/kafkatest"
 )
 
 func TestSyncProducer(t *testing.T) {
-	config := &Config{Endpoints: []string{"10.117.48.122:9092"}}
+	cluster := kafkatest.NewCluster(t)
+	cluster.CreateTopic("test", 1)
 
-	kafka, err := NewKafka(config)
+	kafka, err := NewKafka(&Config{Endpoints: cluster.Endpoints()})
 	if err != nil {
 		t.Errorf("New kafka err: %v.", err)
 		return
 	}
+	defer kafka.Close()
 
-	for i := 0; i <= 100000; i++ {
-		s := &staff{
-			Name: "张三",
-			Age:  i,
-		}
-
-		marshal, err := json.Marshal(s)
+	var values []string
+	for i := 0; i < 3; i++ {
+		marshal, err := json.Marshal(&staff{Name: "张三", Age: i})
 		if err != nil {
 			t.Errorf("Json marshal err: %v.", err)
 			return
@@ -32,30 +32,29 @@ func TestSyncProducer(t *testing.T) {
 		pid, offset, err := kafka.SyncSendMessage("test", "", string(marshal))
 		if err != nil {
 			t.Errorf("Sync send message err: %v.", err)
-			continue
+			return
 		}
 		t.Log(i, pid, offset)
-
-		time.Sleep(time.Second)
+		values = append(values, string(marshal))
 	}
+
+	kafkatest.AssertValues(t, cluster.Produced("test"), values...)
 }
 
 func TestAsyncProducer(t *testing.T) {
-	config := &Config{Endpoints: []string{"10.117.48.122:9092"}}
+	cluster := kafkatest.NewCluster(t)
+	cluster.CreateTopic("test", 1)
 
-	kafka, err := NewKafka(config)
+	kafka, err := NewKafka(&Config{Endpoints: cluster.Endpoints()})
 	if err != nil {
 		t.Errorf("New kafka err: %v.", err)
 		return
 	}
+	defer kafka.Close()
 
-	for i := 20; i <= 100000; i++ {
-		s := &staff{
-			Name: "张三",
-			Age:  i,
-		}
-
-		marshal, err := json.Marshal(s)
+	var values []string
+	for i := 0; i < 3; i++ {
+		marshal, err := json.Marshal(&staff{Name: "张三", Age: i})
 		if err != nil {
 			t.Errorf("Json marshal err: %v.", err)
 			return
@@ -64,76 +63,98 @@ func TestAsyncProducer(t *testing.T) {
 		message, err := kafka.AsyncSendMessage("test", "", string(marshal), time.Duration(3)*time.Second)
 		if err != nil {
 			t.Errorf("Async send message err: %v.", err)
-			continue
+			return
 		}
 		t.Log(message)
-
-		time.Sleep(time.Second)
+		values = append(values, string(marshal))
 	}
+
+	kafkatest.AssertValues(t, cluster.Produced("test"), values...)
 }
 
 func TestConsumer(t *testing.T) {
-	config := &Config{Endpoints: []string{"10.117.48.122:9092"}}
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedValues("test", 0, "a", "b", "c")
 
-	kafka, err := NewKafka(config)
+	kafka, err := NewKafka(&Config{Endpoints: cluster.Endpoints()})
 	if err != nil {
 		t.Errorf("New kafka err: %v.", err)
 		return
 	}
+	defer kafka.Close()
 
 	ch := make(chan *sarama.ConsumerMessage)
-	err = kafka.ConsumeMessage("test", "", -1, ch)
+	err = kafka.ConsumeMessage("test", "", -2, ch)
 	if err != nil {
 		t.Errorf("Kafka consume message err: %v.", err)
 		return
 	}
 
-	for {
+	var got []string
+	for len(got) < 3 {
 		select {
 		case msg := <-ch:
 			t.Logf("Partition: %d, offset: %d, key: %s, value: %s.", msg.Partition, msg.Offset, string(msg.Key), string(msg.Value))
+			got = append(got, string(msg.Value))
 		case <-time.After(time.Duration(3) * time.Second):
-			t.Log("After 3 second.")
+			t.Errorf("Consume timeout, got: %v.", got)
+			return
 		}
 	}
+	if fmt.Sprint(got) != "[a b c]" {
+		t.Errorf("Consume values: %v.", got)
+		return
+	}
 }
 
 func TestConsumerByGroup(t *testing.T) {
-	config := &Config{Endpoints: []string{"10.117.48.122:9092"}}
+	cluster := kafkatest.NewCluster(t)
+	cluster.SeedValues("test", 0, "a", "b", "c")
+	cluster.AddGroup("group_b", "test")
 
-	kafka, err := NewKafka(config)
+	kafka, err := NewKafka(&Config{Endpoints: cluster.Endpoints()})
 	if err != nil {
 		t.Errorf("New kafka err: %v.", err)
 		return
 	}
+	defer kafka.Close()
 
-	handler := &ConsumerGroupHandler{} // 自定义handler
-	err = kafka.ConsumeMessageByGroup([]string{"test"}, "group_b", -1, handler)
+	handler := &ConsumerGroupHandler{limit: 3} // 自定义handler
+	err = kafka.ConsumeMessageByGroup([]string{"test"}, "group_b", -2, handler)
 	if err != nil {
 		t.Errorf("Kafka consume message err: %v.", err)
 		return
 	}
+	if handler.consumed != 3 {
+		t.Errorf("Consumed %d messages, want 3.", handler.consumed)
+		return
+	}
 }
 
 // ConsumerGroupHandler 实现github.com/Shopify/sarama/consumer_group.go/ConsumerGroupHandler 接口
 type ConsumerGroupHandler struct {
+	limit    int // 消费limit 条消息后返回
+	consumed int
 }
 
-func (ConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+func (*ConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
 	//session.ResetOffset("test", 0, 0, "") // 重置偏移
 	return nil
 }
 
-func (ConsumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
+func (*ConsumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
 	return nil
 }
 
 // 消费消息
-func (cgh ConsumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+func (cgh *ConsumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	// 获取消息
 	for {
 		select {
-		case msg := <-claim.Messages():
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
 			fmt.Println(fmt.Sprintf("Message topic:%q, partition:%d, offset:%d, key: %s, value: %s.",
 				msg.Topic,
 				msg.Partition,
@@ -142,13 +163,16 @@ func (cgh ConsumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, c
 				string(msg.Value)))
 
 			// 将消息标记为已使用
-			//sess.MarkMessage(msg, "")
+			sess.MarkMessage(msg, "")
+			cgh.consumed++
+			if cgh.consumed >= cgh.limit {
+				return nil
+			}
 
 		case <-time.After(time.Duration(3) * time.Second):
-			fmt.Println("After 1 second.")
+			return fmt.Errorf("consume timeout, consumed %d", cgh.consumed)
 		}
 	}
-	return nil
 }
 
 type staff struct {
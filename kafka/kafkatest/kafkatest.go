@@ -0,0 +1,535 @@
+// Package kafkatest kafka 包的离线测试工具
+/**
+1. Cluster：基于sarama.MockBroker 的单broker 内存集群，可以预置topic、分区、消息及消费组，记录生产的消息及提交的偏移；
+2. Recorder：基于sarama/mocks 的生产者，记录发送的消息；
+3. AssertValues：断言消息的value。
+*/
+package kafkatest
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+// Version 模拟broker 协商的kafka 版本，客户端Config.Version 需要为空（sarama 默认1.0.0）或该版本
+const Version = "1.0.0"
+
+// Record 消息
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Timestamp time.Time
+}
+
+// Batch 生产请求中的一个RecordBatch（Version >= 0.11.0）
+type Batch struct {
+	Topic         string
+	Partition     int32
+	ProducerID    int64
+	ProducerEpoch int16
+	FirstSequence int32
+	Transactional bool
+	Records       []Record
+}
+
+// Cluster 内存kafka 集群
+/**
+限制：预置的消息不会随生产变化（生产的消息通过Produced 获取）；所有消费组共用同一个分配，
+分配内容为全部消费组订阅topic 的全部分区；提交的偏移不会在重新加入消费组时返回。
+*/
+type Cluster struct {
+	t      testing.TB
+	broker *sarama.MockBroker
+
+	mu            sync.Mutex
+	topics        map[string]int32
+	records       map[string]map[int32][]Record
+	groups        map[string][]string
+	produceErrors map[string]map[int32]sarama.KError
+	compacted     map[string]map[int32]map[int64]bool
+	handlers      map[string]sarama.MockResponse
+}
+
+// NewCluster 新建内存集群，测试结束时自动关闭
+func NewCluster(t testing.TB) *Cluster {
+	c := &Cluster{
+		t:             t,
+		broker:        sarama.NewMockBroker(t, 1),
+		topics:        make(map[string]int32),
+		records:       make(map[string]map[int32][]Record),
+		groups:        make(map[string][]string),
+		produceErrors: make(map[string]map[int32]sarama.KError),
+		compacted:     make(map[string]map[int32]map[int64]bool),
+		handlers:      make(map[string]sarama.MockResponse),
+	}
+	// 追上最新偏移后消费者会持续拉取，加一点延迟避免空转
+	c.broker.SetLatency(5 * time.Millisecond)
+	c.refresh()
+	t.Cleanup(c.Close)
+	return c
+}
+
+// Endpoints 集群地址，用于Config.Endpoints
+func (c *Cluster) Endpoints() []string {
+	return []string{c.broker.Addr()}
+}
+
+// Broker 获取sarama MockBroker
+func (c *Cluster) Broker() *sarama.MockBroker {
+	return c.broker
+}
+
+// CreateTopic 创建topic，已存在时修改分区数
+func (c *Cluster) CreateTopic(topic string, partitions int32) {
+	c.mu.Lock()
+	c.topics[topic] = partitions
+	c.mu.Unlock()
+	c.refresh()
+}
+
+// Seed 在分区末尾追加消息（Topic、Partition、Offset 由集群设置），topic 不存在时按partition+1 个分区创建
+func (c *Cluster) Seed(topic string, partition int32, records ...Record) {
+	c.mu.Lock()
+	if c.topics[topic] <= partition {
+		c.topics[topic] = partition + 1
+	}
+	if c.records[topic] == nil {
+		c.records[topic] = make(map[int32][]Record)
+	}
+	for _, r := range records {
+		r.Topic, r.Partition, r.Offset = topic, partition, int64(len(c.records[topic][partition]))
+		if r.Timestamp.IsZero() {
+			r.Timestamp = time.Now()
+		}
+		c.records[topic][partition] = append(c.records[topic][partition], r)
+	}
+	c.mu.Unlock()
+	c.refresh()
+}
+
+// SeedValues 在分区末尾追加只有value 的消息
+func (c *Cluster) SeedValues(topic string, partition int32, values ...string) {
+	records := make([]Record, 0, len(values))
+	for _, v := range values {
+		records = append(records, Record{Value: []byte(v)})
+	}
+	c.Seed(topic, partition, records...)
+}
+
+// Compact 模拟日志压缩，拉取时不再返回指定偏移的消息，分区的偏移及high-water mark 不变
+func (c *Cluster) Compact(topic string, partition int32, offsets ...int64) {
+	c.mu.Lock()
+	if c.compacted[topic] == nil {
+		c.compacted[topic] = make(map[int32]map[int64]bool)
+	}
+	if c.compacted[topic][partition] == nil {
+		c.compacted[topic][partition] = make(map[int64]bool)
+	}
+	for _, offset := range offsets {
+		c.compacted[topic][partition][offset] = true
+	}
+	c.mu.Unlock()
+	c.refresh()
+}
+
+// AddGroup 添加消费组，订阅topics 的全部分区，没有已提交的偏移
+func (c *Cluster) AddGroup(group string, topics ...string) {
+	c.mu.Lock()
+	c.groups[group] = topics
+	c.mu.Unlock()
+	c.refresh()
+}
+
+// SetProduceError 设置分区生产时返回的错误，sarama.ErrNoError 表示恢复
+func (c *Cluster) SetProduceError(topic string, partition int32, kerr sarama.KError) {
+	c.mu.Lock()
+	if c.produceErrors[topic] == nil {
+		c.produceErrors[topic] = make(map[int32]sarama.KError)
+	}
+	c.produceErrors[topic][partition] = kerr
+	c.mu.Unlock()
+	c.refresh()
+}
+
+// SetHandler 设置请求（例如"EndTxnRequest"）的响应，覆盖集群默认的响应，response 为nil 时恢复默认
+func (c *Cluster) SetHandler(request string, response sarama.MockResponse) {
+	c.mu.Lock()
+	if response == nil {
+		delete(c.handlers, request)
+	} else {
+		c.handlers[request] = response
+	}
+	c.mu.Unlock()
+	c.refresh()
+}
+
+// ProducedBatches 获取生产到topic 的RecordBatch（按请求顺序，同一请求内按分区排序），用于检查producer id、epoch 及序列号
+func (c *Cluster) ProducedBatches(topic string) []Batch {
+	c.t.Helper()
+
+	var batches []Batch
+	for _, rr := range c.broker.History() {
+		req, ok := rr.Request.(*sarama.ProduceRequest)
+		if !ok {
+			continue
+		}
+		partitions := c.field(reflect.ValueOf(req).Elem(), "records").MapIndex(reflect.ValueOf(topic))
+		if !partitions.IsValid() {
+			continue
+		}
+
+		keys := partitions.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+		for _, key := range keys {
+			batch := c.field(partitions.MapIndex(key), "RecordBatch")
+			if batch.IsNil() {
+				continue
+			}
+			b := batch.Elem()
+			partition := int32(key.Int())
+			batches = append(batches, Batch{
+				Topic:         topic,
+				Partition:     partition,
+				ProducerID:    c.field(b, "ProducerID").Int(),
+				ProducerEpoch: int16(c.field(b, "ProducerEpoch").Int()),
+				FirstSequence: int32(c.field(b, "FirstSequence").Int()),
+				Transactional: c.field(b, "IsTransactional").Bool(),
+				Records:       c.batchRecords(b, topic, partition),
+			})
+		}
+	}
+	return batches
+}
+
+// Produced 获取生产到topic 的消息（按请求顺序，分区内按发送顺序），Offset 为批次内的偏移，不包含Timestamp
+func (c *Cluster) Produced(topic string) []Record {
+	c.t.Helper()
+
+	var records []Record
+	for _, rr := range c.broker.History() {
+		req, ok := rr.Request.(*sarama.ProduceRequest)
+		if !ok {
+			continue
+		}
+		records = append(records, c.produceRecords(req, topic)...)
+	}
+	return records
+}
+
+// Committed 获取消费组提交的分区偏移（最后一次），没有提交时返回-1
+func (c *Cluster) Committed(group, topic string, partition int32) int64 {
+	c.t.Helper()
+
+	offset := int64(-1)
+	for _, rr := range c.broker.History() {
+		req, ok := rr.Request.(*sarama.OffsetCommitRequest)
+		if !ok || req.ConsumerGroup != group {
+			continue
+		}
+		// OffsetCommitRequest 没有导出偏移，通过反射读取
+		blocks := c.field(reflect.ValueOf(req).Elem(), "blocks")
+		partitions := blocks.MapIndex(reflect.ValueOf(topic))
+		if !partitions.IsValid() {
+			continue
+		}
+		block := partitions.MapIndex(reflect.ValueOf(partition))
+		if !block.IsValid() || block.IsNil() {
+			continue
+		}
+		offset = c.field(block.Elem(), "offset").Int()
+	}
+	return offset
+}
+
+// Close 关闭集群
+func (c *Cluster) Close() {
+	c.broker.Close()
+}
+
+// refresh 根据当前状态重新设置MockBroker 的响应
+func (c *Cluster) refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, id := c.t, c.broker.BrokerID()
+	metadata := sarama.NewMockMetadataResponse(t).SetBroker(c.broker.Addr(), id).SetController(id)
+	offsets := sarama.NewMockOffsetResponse(t)
+	fetch := &sarama.FetchResponse{Version: 4}
+	produce := sarama.NewMockProduceResponse(t).SetVersion(3)
+	coordinator := sarama.NewMockFindCoordinatorResponse(t)
+	offsetFetch := sarama.NewMockOffsetFetchResponse(t)
+	assignment := &sarama.ConsumerGroupMemberAssignment{Topics: make(map[string][]int32)}
+
+	for topic, n := range c.topics {
+		for p := int32(0); p < n; p++ {
+			metadata.SetLeader(topic, p, id)
+
+			records := c.records[topic][p]
+			offsets.SetOffset(topic, p, sarama.OffsetOldest, 0).SetOffset(topic, p, sarama.OffsetNewest, int64(len(records)))
+
+			fetch.AddError(topic, p, sarama.ErrNoError)
+			for _, r := range records {
+				if c.compacted[topic][p][r.Offset] {
+					continue
+				}
+				fetch.AddRecordWithTimestamp(topic, p, encoder(r.Key), encoder(r.Value), r.Offset, r.Timestamp)
+				if len(r.Headers) > 0 {
+					batch := fetch.GetBlock(topic, p).RecordsSet[0].RecordBatch
+					record := batch.Records[len(batch.Records)-1]
+					for k, v := range r.Headers {
+						record.Headers = append(record.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+					}
+				}
+			}
+			fetch.GetBlock(topic, p).HighWaterMarkOffset = int64(len(records))
+		}
+	}
+	for topic, partitions := range c.produceErrors {
+		for p, kerr := range partitions {
+			produce.SetError(topic, p, kerr)
+		}
+	}
+	for group, topics := range c.groups {
+		coordinator.SetCoordinator(sarama.CoordinatorGroup, group, c.broker)
+		for _, topic := range topics {
+			assignment.Topics[topic] = nil
+			for p := int32(0); p < c.topics[topic]; p++ {
+				offsetFetch.SetOffset(group, topic, p, -1, "", sarama.ErrNoError)
+				assignment.Topics[topic] = append(assignment.Topics[topic], p)
+			}
+		}
+	}
+
+	handlers := map[string]sarama.MockResponse{
+		"MetadataRequest":        metadata,
+		"OffsetRequest":          offsets,
+		"FetchRequest":           sarama.NewMockWrapper(fetch),
+		"ProduceRequest":         produce,
+		"FindCoordinatorRequest": coordinator,
+		"OffsetFetchRequest":     offsetFetch,
+		"OffsetCommitRequest":    sarama.NewMockOffsetCommitResponse(t),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).
+			SetGroupProtocol(sarama.BalanceStrategyRange.Name()).
+			SetGenerationId(1).
+			SetMemberId("kafkatest-member").
+			SetLeaderId("kafkatest-leader"), // 非leader，直接使用SyncGroup 返回的分配
+		"SyncGroupRequest":  sarama.NewMockSyncGroupResponse(t).SetMemberAssignment(assignment),
+		"HeartbeatRequest":  sarama.NewMockHeartbeatResponse(t),
+		"LeaveGroupRequest": sarama.NewMockLeaveGroupResponse(t),
+	}
+	for request, response := range c.handlers {
+		handlers[request] = response
+	}
+	c.broker.SetHandlerByMap(handlers)
+}
+
+// encoder nil 保持为nil
+func encoder(b []byte) sarama.Encoder {
+	if b == nil {
+		return nil
+	}
+	return sarama.ByteEncoder(b)
+}
+
+// produceRecords 获取生产请求中topic 的消息
+/**
+ProduceRequest 没有导出消息，通过反射（只读）读取records 字段；只读的time.Time 无法读取，因此不包含Timestamp。
+*/
+func (c *Cluster) produceRecords(req *sarama.ProduceRequest, topic string) []Record {
+	c.t.Helper()
+
+	partitions := c.field(reflect.ValueOf(req).Elem(), "records").MapIndex(reflect.ValueOf(topic))
+	if !partitions.IsValid() {
+		return nil
+	}
+
+	keys := partitions.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+
+	var records []Record
+	for _, key := range keys {
+		partition := int32(key.Int())
+		set := partitions.MapIndex(key)
+
+		if batch := c.field(set, "RecordBatch"); !batch.IsNil() {
+			records = append(records, c.batchRecords(batch.Elem(), topic, partition)...)
+			continue
+		}
+		if msgSet := c.field(set, "MsgSet"); !msgSet.IsNil() {
+			records = append(records, c.messageSetRecords(msgSet.Elem(), topic, partition)...)
+		}
+	}
+	return records
+}
+
+// batchRecords 读取RecordBatch（Version >= 0.11.0）中的消息
+func (c *Cluster) batchRecords(batch reflect.Value, topic string, partition int32) []Record {
+	c.t.Helper()
+
+	var records []Record
+	rs := c.field(batch, "Records")
+	for i := 0; i < rs.Len(); i++ {
+		r := rs.Index(i).Elem()
+		record := Record{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    c.field(r, "OffsetDelta").Int(),
+			Key:       reflectBytes(c.field(r, "Key")),
+			Value:     reflectBytes(c.field(r, "Value")),
+		}
+		if hs := c.field(r, "Headers"); hs.Len() > 0 {
+			record.Headers = make(map[string]string, hs.Len())
+			for j := 0; j < hs.Len(); j++ {
+				h := hs.Index(j).Elem()
+				record.Headers[string(reflectBytes(c.field(h, "Key")))] = string(reflectBytes(c.field(h, "Value")))
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// messageSetRecords 读取旧版本（Version < 0.11.0）的消息，压缩的消息读取内层
+func (c *Cluster) messageSetRecords(set reflect.Value, topic string, partition int32) []Record {
+	c.t.Helper()
+
+	var records []Record
+	blocks := c.field(set, "Messages")
+	for i := 0; i < blocks.Len(); i++ {
+		block := blocks.Index(i).Elem()
+		msg := c.field(block, "Msg").Elem()
+		if inner := c.field(msg, "Set"); !inner.IsNil() {
+			records = append(records, c.messageSetRecords(inner.Elem(), topic, partition)...)
+			continue
+		}
+		records = append(records, Record{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    c.field(block, "Offset").Int(),
+			Key:       reflectBytes(c.field(msg, "Key")),
+			Value:     reflectBytes(c.field(msg, "Value")),
+		})
+	}
+	return records
+}
+
+// field 通过反射读取字段，字段不存在（sarama 版本变化）时测试失败
+func (c *Cluster) field(v reflect.Value, name string) reflect.Value {
+	c.t.Helper()
+
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		c.t.Fatalf("kafkatest: %s has no field '%s', the sarama version is not supported.", v.Type(), name)
+	}
+	return f
+}
+
+// reflectBytes 复制[]byte 字段
+func reflectBytes(v reflect.Value) []byte {
+	if v.IsNil() {
+		return nil
+	}
+	return append([]byte(nil), v.Bytes()...)
+}
+
+// Recorder 基于sarama/mocks 的生产者，记录发送的消息
+type Recorder struct {
+	mu       sync.Mutex
+	messages []*sarama.ProducerMessage
+}
+
+// NewRecorder 新建Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// SyncProducer 新建预期成功发送n 条消息的mocks.SyncProducer，发送的消息记录在Recorder 中
+func (r *Recorder) SyncProducer(t mocks.ErrorReporter, n int) *mocks.SyncProducer {
+	sp := mocks.NewSyncProducer(t, nil)
+	for i := 0; i < n; i++ {
+		sp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(r.record)
+	}
+	return sp
+}
+
+// AsyncProducer 新建预期成功发送n 条消息的mocks.AsyncProducer（返回Successes），发送的消息记录在Recorder 中
+func (r *Recorder) AsyncProducer(t mocks.ErrorReporter, n int) *mocks.AsyncProducer {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	ap := mocks.NewAsyncProducer(t, config)
+	for i := 0; i < n; i++ {
+		ap.ExpectInputWithMessageCheckerFunctionAndSucceed(r.record)
+	}
+	return ap
+}
+
+// Records 获取已发送的消息
+func (r *Recorder) Records(topic string) []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var records []Record
+	for _, msg := range r.messages {
+		if msg.Topic != topic {
+			continue
+		}
+		record := Record{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset, Timestamp: msg.Timestamp}
+		record.Key, _ = encodeBytes(msg.Key)
+		record.Value, _ = encodeBytes(msg.Value)
+		if len(msg.Headers) > 0 {
+			record.Headers = make(map[string]string, len(msg.Headers))
+			for _, h := range msg.Headers {
+				record.Headers[string(h.Key)] = string(h.Value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// record 记录消息（mocks.MessageChecker）
+func (r *Recorder) record(msg *sarama.ProducerMessage) error {
+	r.mu.Lock()
+	r.messages = append(r.messages, msg)
+	r.mu.Unlock()
+	return nil
+}
+
+// encodeBytes Encoder 为nil 时返回nil
+func encodeBytes(e sarama.Encoder) ([]byte, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return e.Encode()
+}
+
+// AssertValues 断言消息的value 依次为values
+func AssertValues(t testing.TB, records []Record, values ...string) bool {
+	t.Helper()
+
+	if len(records) != len(values) {
+		got := make([]string, 0, len(records))
+		for _, r := range records {
+			got = append(got, string(r.Value))
+		}
+		t.Errorf("records values: %q, want: %q.", got, values)
+		return false
+	}
+	for i, r := range records {
+		if string(r.Value) != values[i] {
+			t.Errorf("record %d value: %q, want: %q.", i, r.Value, values[i])
+			return false
+		}
+	}
+	return true
+}
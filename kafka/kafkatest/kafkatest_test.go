@@ -0,0 +1,66 @@
+package kafkatest
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestClusterProduced(t *testing.T) {
+	cluster := NewCluster(t)
+	cluster.CreateTopic("test", 2)
+	cluster.SetProduceError("test", 1, sarama.ErrMessageSizeTooLarge)
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Retry.Max = 0
+	config.Producer.Partitioner = sarama.NewManualPartitioner
+	producer, err := sarama.NewSyncProducer(cluster.Endpoints(), config)
+	if err != nil {
+		t.Errorf("New sync producer err: %v.", err)
+		return
+	}
+	defer producer.Close()
+
+	_, _, err = producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   "test",
+		Key:     sarama.StringEncoder("k"),
+		Value:   sarama.StringEncoder("a"),
+		Headers: []sarama.RecordHeader{{Key: []byte("h"), Value: []byte("v")}},
+	})
+	if err != nil {
+		t.Errorf("Send message err: %v.", err)
+		return
+	}
+	if _, _, err := producer.SendMessage(&sarama.ProducerMessage{Topic: "test", Partition: 1, Value: sarama.StringEncoder("b")}); err == nil {
+		t.Errorf("Send message to partition 1 should fail.")
+		return
+	}
+
+	records := cluster.Produced("test")
+	if !AssertValues(t, records[:1], "a") {
+		return
+	}
+	if string(records[0].Key) != "k" || records[0].Headers["h"] != "v" || records[0].Partition != 0 {
+		t.Errorf("Produced record: %+v.", records[0])
+		return
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := NewRecorder()
+
+	sp := recorder.SyncProducer(t, 1)
+	if _, _, err := sp.SendMessage(&sarama.ProducerMessage{Topic: "test", Value: sarama.StringEncoder("a")}); err != nil {
+		t.Errorf("Sync send err: %v.", err)
+		return
+	}
+	_ = sp.Close()
+
+	ap := recorder.AsyncProducer(t, 1)
+	ap.Input() <- &sarama.ProducerMessage{Topic: "test", Value: sarama.StringEncoder("b")}
+	<-ap.Successes()
+	_ = ap.Close()
+
+	AssertValues(t, recorder.Records("test"), "a", "b")
+}
@@ -0,0 +1,215 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	SerializerJSON     = "json"
+	SerializerProtobuf = "protobuf"
+
+	HeaderContentType = "content-type" // SendObject 写入序列化方式的名称
+)
+
+// Message 通用消息（生产及消费）
+/**
+Headers、Timestamp 要求Version >= 0.11.0/0.10.0；Partition 生产时只有PartitionerManual 下有效，Offset 只在消费时有效。
+*/
+type Message struct {
+	Topic     string
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Timestamp time.Time
+	Partition int32
+	Offset    int64
+}
+
+func (msg *Message) String() string {
+	return fmt.Sprintf("[kafka]Topic: %s, partition: %d, offset: %d, key: %s, value: %s, headers: %v, timestamp: %v.",
+		msg.Topic, msg.Partition, msg.Offset, string(msg.Key), string(msg.Value), msg.Headers, msg.Timestamp)
+}
+
+// ProducerMessage 转换为sarama 生产消息
+func (msg *Message) ProducerMessage() *sarama.ProducerMessage {
+	pm := &sarama.ProducerMessage{Topic: msg.Topic, Partition: msg.Partition, Timestamp: msg.Timestamp}
+	if msg.Key != nil {
+		pm.Key = sarama.ByteEncoder(msg.Key)
+	}
+	if msg.Value != nil {
+		pm.Value = sarama.ByteEncoder(msg.Value)
+	}
+	for k, v := range msg.Headers {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return pm
+}
+
+// NewMessage 从sarama 消费消息转换，同名header 保留最后一个
+func NewMessage(cm *sarama.ConsumerMessage) *Message {
+	msg := &Message{
+		Topic:     cm.Topic,
+		Key:       cm.Key,
+		Value:     cm.Value,
+		Timestamp: cm.Timestamp,
+		Partition: cm.Partition,
+		Offset:    cm.Offset,
+	}
+	if len(cm.Headers) > 0 {
+		msg.Headers = make(map[string]string, len(cm.Headers))
+		for _, h := range cm.Headers {
+			msg.Headers[string(h.Key)] = string(h.Value)
+		}
+	}
+	return msg
+}
+
+// Serializer 消息序列化方式
+type Serializer interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	serializersMu sync.RWMutex
+	serializers   = map[string]Serializer{
+		SerializerJSON:     JSONSerializer{},
+		SerializerProtobuf: ProtobufSerializer{},
+	}
+)
+
+// RegisterSerializer 注册序列化方式（例如Avro），消费时根据content-type header 查找
+func RegisterSerializer(serializer Serializer) {
+	serializersMu.Lock()
+	defer serializersMu.Unlock()
+	serializers[serializer.Name()] = serializer
+}
+
+// GetSerializer 根据名称获取序列化方式，name 为空时返回JSON
+func GetSerializer(name string) (Serializer, error) {
+	if name == "" {
+		name = SerializerJSON
+	}
+
+	serializersMu.RLock()
+	defer serializersMu.RUnlock()
+	s, ok := serializers[name]
+	if !ok {
+		return nil, fmt.Errorf("[kafka]unknown serializer '%s'", name)
+	}
+	return s, nil
+}
+
+// JSONSerializer encoding/json
+type JSONSerializer struct{}
+
+func (JSONSerializer) Name() string {
+	return SerializerJSON
+}
+
+func (JSONSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONSerializer) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufSerializer protobuf，value 需要实现proto.Message
+type ProtobufSerializer struct{}
+
+func (ProtobufSerializer) Name() string {
+	return SerializerProtobuf
+}
+
+func (ProtobufSerializer) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.New("[kafka]protobuf value must be proto.Message")
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtobufSerializer) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.New("[kafka]protobuf value must be proto.Message")
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// SyncSend 同步发送消息
+func (p *Producer) SyncSend(msg *Message) (int32, int64, error) {
+	if msg == nil || msg.Topic == "" {
+		return 0, 0, errors.New("[kafka]message is nil or topic is '', please check")
+	}
+	return p.SyncProducer.SendMessage(msg.ProducerMessage())
+}
+
+// SendObject 序列化value 后同步发送，序列化方式的名称写入content-type header（serializer 为nil 时使用JSON）
+func (p *Producer) SendObject(topic, key string, value interface{}, serializer Serializer) (int32, int64, error) {
+	msg, err := NewObjectMessage(topic, key, value, serializer)
+	if err != nil {
+		return 0, 0, err
+	}
+	return p.SyncSend(msg)
+}
+
+// NewObjectMessage 序列化value 生成消息，序列化方式的名称写入content-type header（serializer 为nil 时使用JSON）
+func NewObjectMessage(topic, key string, value interface{}, serializer Serializer) (*Message, error) {
+	if serializer == nil {
+		serializer = JSONSerializer{}
+	}
+	data, err := serializer.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{Topic: topic, Value: data, Headers: map[string]string{HeaderContentType: serializer.Name()}}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
+	return msg, nil
+}
+
+// DecodeMessage 反序列化消息
+/**
+serializer 为nil 时根据content-type header 查找（没有header 时使用JSON）；T 为指针时自动分配，例如DecodeMessage[*pb.User]。
+*/
+func DecodeMessage[T any](cm *sarama.ConsumerMessage, serializer Serializer) (T, error) {
+	var v T
+	if serializer == nil {
+		s, err := GetSerializer(recordHeader(cm.Headers, HeaderContentType))
+		if err != nil {
+			return v, err
+		}
+		serializer = s
+	}
+
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr {
+		v = reflect.New(t.Elem()).Interface().(T)
+		return v, serializer.Unmarshal(cm.Value, v)
+	}
+	return v, serializer.Unmarshal(cm.Value, &v)
+}
+
+// TypedHandler 将类型化的处理函数转换为MessageHandler，反序列化失败时返回错误（按GroupConsumer 的配置重试）
+func TypedHandler[T any](serializer Serializer, handler func(ctx context.Context, msg *Message, value T) error) MessageHandler {
+	return func(ctx context.Context, cm *sarama.ConsumerMessage) error {
+		v, err := DecodeMessage[T](cm, serializer)
+		if err != nil {
+			return fmt.Errorf("[kafka]decode message topic '%s' partition %d offset %d err: %w", cm.Topic, cm.Partition, cm.Offset, err)
+		}
+		return handler(ctx, NewMessage(cm), v)
+	}
+}
@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMessage(t *testing.T) {
+	msg := &Message{
+		Topic:     "test",
+		Key:       []byte("key"),
+		Value:     []byte{0x00, 0xff},
+		Headers:   map[string]string{"trace-id": "abc"},
+		Timestamp: time.Unix(1600000000, 0),
+	}
+	pm := msg.ProducerMessage()
+	if pm.Topic != "test" || len(pm.Headers) != 1 || !pm.Timestamp.Equal(msg.Timestamp) {
+		t.Errorf("Producer message unexpected: %+v.", pm)
+		return
+	}
+
+	cm := &sarama.ConsumerMessage{Topic: "test", Partition: 1, Offset: 10, Value: []byte{0x00, 0xff},
+		Headers: []*sarama.RecordHeader{{Key: []byte("trace-id"), Value: []byte("abc")}}}
+	if m := NewMessage(cm); m.Headers["trace-id"] != "abc" || m.Offset != 10 {
+		t.Errorf("Message from consumer unexpected: %s", m)
+		return
+	}
+}
+
+func TestSendObject(t *testing.T) {
+	sp := mocks.NewSyncProducer(t, nil)
+	p := &Producer{SyncProducer: sp}
+
+	var sent *sarama.ProducerMessage
+	sp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		sent = msg
+		return nil
+	})
+	if _, _, err := p.SendObject("test", "key", wrapperspb.String("value"), ProtobufSerializer{}); err != nil {
+		t.Errorf("Send object err: %v.", err)
+		return
+	}
+
+	// 根据content-type header 反序列化
+	value, _ := sent.Value.Encode()
+	cm := &sarama.ConsumerMessage{Topic: "test", Value: value, Headers: []*sarama.RecordHeader{{Key: []byte(HeaderContentType), Value: []byte(SerializerProtobuf)}}}
+	v, err := DecodeMessage[*wrapperspb.StringValue](cm, nil)
+	if err != nil || v.GetValue() != "value" {
+		t.Errorf("Decode protobuf message unexpected: %v, %v.", v, err)
+		return
+	}
+
+	type user struct {
+		Name string `json:"name"`
+	}
+	handler := TypedHandler[user](JSONSerializer{}, func(ctx context.Context, msg *Message, value user) error {
+		if value.Name != "user_1" {
+			t.Errorf("Typed handler unexpected value: %+v.", value)
+		}
+		return nil
+	})
+	if err := handler(context.Background(), &sarama.ConsumerMessage{Value: []byte(`{"name":"user_1"}`)}); err != nil {
+		t.Errorf("Typed handler err: %v.", err)
+		return
+	}
+	if err := handler(context.Background(), &sarama.ConsumerMessage{Value: []byte(`invalid`)}); err == nil {
+		t.Errorf("Typed handler with invalid value should return err.")
+		return
+	}
+
+	if err := sp.Close(); err != nil {
+		t.Errorf("Mock producer close err: %v.", err)
+		return
+	}
+}
@@ -1,17 +1,53 @@
 package kafka
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"sync"
 	"time"
 )
 
+// ErrProducerClosed 生产者已关闭
+var ErrProducerClosed = errors.New("[kafka]producer is closed")
+
+// SendCallback 异步发送结果回调，err 为nil 表示发送成功（msg 中的Partition、Offset 有效）
+/**
+回调在独立的后台协程中按确认顺序执行，不会阻塞确认的读取，可以在回调中调用Send；
+回调中不能调用Flush、Close（二者等待回调执行完毕）。
+*/
+type SendCallback func(msg *sarama.ProducerMessage, err error)
+
 // Producer 生产者
+/**
+AsyncProducer 的Successes()/Errors() 由后台协程读取并调用Send 的回调，不能直接读取，否则会拿走Send 的确认；
+直接写入Input() 的消息，其确认同样由后台协程读取（失败时记录日志）。
+*/
 type Producer struct {
 	sarama.SyncProducer  // 同步生产者
 	sarama.AsyncProducer // 异步生产者
 	cfg                  *Config
+
+	mu         sync.RWMutex // 保护closed，发送期间持有读锁
+	closed     bool
+	imu        sync.Mutex
+	inflight   int           // 已发送未确认的消息数
+	idle       chan struct{} // inflight 归零时关闭
+	dispatched chan struct{} // 后台协程退出时关闭
+
+	cmu       sync.Mutex
+	ccond     *sync.Cond
+	callbacks []func() // 等待执行的回调
+	cstop     bool     // dispatch 已退出，执行完剩余回调后退出
+	called    chan struct{}
+}
+
+// sendMetadata 替换消息的Metadata，用于确认时找到回调
+type sendMetadata struct {
+	callback SendCallback
+	metadata interface{} // 原Metadata
 }
 
 // NewProducer 新建生产者
@@ -20,40 +56,187 @@ func NewProducer(cfg *Config) (*Producer, error) {
 		cfg: cfg,
 	}
 
-	// 新建同步消费者
-	syncConfig := sarama.NewConfig()
-	syncConfig.Producer.RequiredAcks = sarama.WaitForAll
-	syncConfig.Producer.Partitioner = sarama.NewRandomPartitioner
+	// 新建同步生产者
+	syncConfig, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 	syncConfig.Producer.Return.Successes = true
 	syncConfig.Producer.Return.Errors = true
-	// 设置使用的kafka版本,如果低于V0_10_0_0版本,消息中的timestrap 没有作用。需要消费和生产同时配置
-	// 注意，版本设置不对的话，kafka 会返回很奇怪的错误，并且无法成功发送消息
-	//syncConfig.Version = sarama.V0_10_2_1
 	syncProducer, err := sarama.NewSyncProducer(cfg.Endpoints, syncConfig)
 	if err != nil {
 		return nil, err
 	}
 	p.SyncProducer = syncProducer
 
-	// 新建异步消费者
-	asynConfig := sarama.NewConfig()
-	asynConfig.Producer.RequiredAcks = sarama.WaitForAll
-	asynConfig.Producer.Partitioner = sarama.NewRandomPartitioner
+	// 新建异步生产者
+	asynConfig, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 	asynConfig.Producer.Return.Successes = true
 	asynConfig.Producer.Return.Errors = true
-	// 设置使用的kafka版本,如果低于V0_10_0_0版本,消息中的timestrap 没有作用。需要消费和生产同时配置
-	// 注意，版本设置不对的话，kafka 会返回很奇怪的错误，并且无法成功发送消息
-	//asynConfig.Version = sarama.V0_10_2_1
 	asyncProducer, err := sarama.NewAsyncProducer(cfg.Endpoints, asynConfig)
 	if err != nil {
 		return nil, err
 	}
 	p.AsyncProducer = asyncProducer
 
+	p.start()
 	return p, nil
 }
 
-// SyncSendMessage 同步生产者发送消息
+// start 启动后台协程读取AsyncProducer 的确认及执行回调
+func (p *Producer) start() {
+	p.idle = make(chan struct{})
+	p.dispatched = make(chan struct{})
+	p.called = make(chan struct{})
+	p.ccond = sync.NewCond(&p.cmu)
+	go p.dispatch()
+	go p.runCallbacks()
+}
+
+// Send 异步发送消息，不等待确认，发送结果通过callback 返回（callback 可以为nil）
+/**
+msg.Metadata 在发送期间被替换，回调时恢复；Input 缓冲满时会阻塞。
+*/
+func (p *Producer) Send(msg *sarama.ProducerMessage, callback SendCallback) error {
+	if msg == nil || msg.Topic == "" {
+		return errors.New("[kafka]message is nil or topic is '', please check")
+	}
+
+	// 读锁保证Close 不会在发送过程中关闭Input
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	p.imu.Lock()
+	p.inflight++
+	p.imu.Unlock()
+
+	msg.Metadata = &sendMetadata{callback: callback, metadata: msg.Metadata}
+	p.AsyncProducer.Input() <- msg
+	return nil
+}
+
+// Flush 等待已经Send 的消息全部确认（成功或失败），ctx 被取消时返回ctx.Err()
+func (p *Producer) Flush(ctx context.Context) error {
+	p.imu.Lock()
+	if p.inflight == 0 {
+		p.imu.Unlock()
+		return nil
+	}
+	idle := p.idle
+	p.imu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-idle:
+		return nil
+	}
+}
+
+// SendMessages 同步批量发送消息，部分失败时返回sarama.ProducerErrors
+func (p *Producer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	return p.SyncProducer.SendMessages(msgs)
+}
+
+// dispatch 读取AsyncProducer 的确认并将回调加入队列，直到AsyncProducer 关闭
+func (p *Producer) dispatch() {
+	defer func() {
+		p.cmu.Lock()
+		p.cstop = true
+		p.cmu.Unlock()
+		p.ccond.Signal()
+		close(p.dispatched)
+	}()
+
+	successes, errs := p.AsyncProducer.Successes(), p.AsyncProducer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			p.complete(msg, nil)
+		case pe, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			p.complete(pe.Msg, pe.Err)
+		}
+	}
+}
+
+// complete 恢复Metadata，将回调加入队列
+func (p *Producer) complete(msg *sarama.ProducerMessage, err error) {
+	meta, ok := msg.Metadata.(*sendMetadata)
+	if !ok {
+		// 直接写入AsyncProducer.Input() 的消息
+		if err != nil {
+			logrus.Errorf("[kafka]async send message topic '%s' err: %v.", msg.Topic, err)
+		}
+		return
+	}
+
+	msg.Metadata = meta.metadata
+	p.cmu.Lock()
+	p.callbacks = append(p.callbacks, func() {
+		if meta.callback != nil {
+			meta.callback(msg, err)
+		}
+		p.ack()
+	})
+	p.cmu.Unlock()
+	p.ccond.Signal()
+}
+
+// runCallbacks 按顺序执行回调，dispatch 退出且队列为空时退出
+/**
+回调与确认的读取分开执行，回调中Send 阻塞在Input() 时dispatch 仍然可以读取确认。
+*/
+func (p *Producer) runCallbacks() {
+	defer close(p.called)
+
+	for {
+		p.cmu.Lock()
+		for len(p.callbacks) == 0 && !p.cstop {
+			p.ccond.Wait()
+		}
+		callbacks := p.callbacks
+		p.callbacks = nil
+		p.cmu.Unlock()
+
+		if len(callbacks) == 0 {
+			return
+		}
+		for _, f := range callbacks {
+			f()
+		}
+	}
+}
+
+// ack 减少inflight，归零时唤醒Flush
+func (p *Producer) ack() {
+	p.imu.Lock()
+	defer p.imu.Unlock()
+
+	p.inflight--
+	if p.inflight == 0 {
+		close(p.idle)
+		p.idle = make(chan struct{})
+	}
+}
+
+// SyncSendMessage 同步生产者发送消息（需要header、timestamp 或二进制数据时使用SyncSend）
 func (p *Producer) SyncSendMessage(topic, key, value string) (int32, int64, error) {
 	if topic == "" {
 		return 0, 0, errors.New("[kafka]topic is '', please check")
@@ -77,7 +260,7 @@ func (p *Producer) SyncSendMessage(topic, key, value string) (int32, int64, erro
 	return pid, offset, nil
 }
 
-// AsyncSendMessage 异步生产者发送消息
+// AsyncSendMessage 异步生产者发送消息，等待确认后返回（并发吞吐量需要使用Send）
 func (p *Producer) AsyncSendMessage(topic, key, value string, timeOut time.Duration) (*sarama.ProducerMessage, error) {
 	if topic == "" {
 		return nil, errors.New("[kafka]topic is '', please check")
@@ -98,29 +281,37 @@ func (p *Producer) AsyncSendMessage(topic, key, value string, timeOut time.Durat
 		timeOut = time.Duration(60) * time.Second // 默认60s
 	}
 
-	// 使用通道发送
-	p.AsyncProducer.Input() <- msg
+	// 通过回调等待本条消息的确认
+	ch := make(chan error, 1)
+	if err := p.Send(msg, func(_ *sarama.ProducerMessage, err error) { ch <- err }); err != nil {
+		return nil, err
+	}
 
-	for {
-		select {
-		case success := <-p.Successes():
-			return success, nil
-		case fail := <-p.Errors():
-			return nil, fail.Err
-		case <-time.After(timeOut):
-			return nil, errors.New(fmt.Sprintf("[kafka]async send message time out, send msg topic: %s, key: %s, value: %s", topic, key, value))
+	select {
+	case err := <-ch:
+		if err != nil {
+			return nil, err
 		}
+		return msg, nil
+	case <-time.After(timeOut):
+		return nil, errors.New(fmt.Sprintf("[kafka]async send message time out, send msg topic: %s, key: %s, value: %s", topic, key, value))
 	}
-
 }
 
-// Close 关闭生产者
+// Close 关闭生产者，等待已发送的消息确认并调用回调后返回
 func (p *Producer) Close() error {
-	_ = p.SyncProducer.Close()
-
-	if err := p.AsyncProducer.Close(); err != nil {
-		return err
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
 	}
+	p.closed = true
+	p.mu.Unlock()
 
-	return nil
+	err := p.SyncProducer.Close()
+	p.AsyncProducer.AsyncClose()
+	<-p.dispatched
+	<-p.called
+
+	return err
 }
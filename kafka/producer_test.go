@@ -0,0 +1,119 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+)
+
+func TestProducerSend(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+
+	async := mocks.NewAsyncProducer(t, config)
+	p := &Producer{SyncProducer: mocks.NewSyncProducer(t, nil), AsyncProducer: async}
+	p.start()
+
+	sendErr := errors.New("send err")
+	var (
+		mu      sync.Mutex
+		results = make(map[int]error)
+	)
+	for i := 0; i < 10; i++ {
+		if i%3 == 0 {
+			async.ExpectInputAndFail(sendErr)
+		} else {
+			async.ExpectInputAndSucceed()
+		}
+		msg := &sarama.ProducerMessage{Topic: "test", Value: sarama.StringEncoder("value"), Metadata: i}
+		if err := p.Send(msg, func(msg *sarama.ProducerMessage, err error) {
+			mu.Lock()
+			results[msg.Metadata.(int)] = err
+			mu.Unlock()
+		}); err != nil {
+			t.Errorf("Send err: %v.", err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := p.Flush(ctx); err != nil {
+		t.Errorf("Flush err: %v.", err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(results) != 10 {
+		t.Errorf("Callback count unexpected: %d.", len(results))
+		return
+	}
+	for i, err := range results {
+		if (i%3 == 0) != (err == sendErr) {
+			t.Errorf("Message %d callback err unexpected: %v.", i, err)
+			return
+		}
+	}
+
+	if err := p.Close(); err != nil {
+		t.Errorf("Close err: %v.", err)
+		return
+	}
+	if err := p.Send(&sarama.ProducerMessage{Topic: "test"}, nil); err != ErrProducerClosed {
+		t.Errorf("Send after close unexpected err: %v.", err)
+		return
+	}
+}
+
+func TestProducerSendFromCallback(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	config.ChannelBufferSize = 0
+
+	async := mocks.NewAsyncProducer(t, config)
+	p := &Producer{SyncProducer: mocks.NewSyncProducer(t, nil), AsyncProducer: async}
+	p.start()
+
+	// 回调中继续Send，不会阻塞确认的读取
+	const n = 20
+	done := make(chan struct{})
+	var callback SendCallback
+	sent := 1
+	callback = func(msg *sarama.ProducerMessage, err error) {
+		if err != nil {
+			t.Errorf("Send callback err: %v.", err)
+		}
+		if sent == n {
+			close(done)
+			return
+		}
+		sent++
+		if err := p.Send(&sarama.ProducerMessage{Topic: "test"}, callback); err != nil {
+			t.Errorf("Send from callback err: %v.", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		async.ExpectInputAndSucceed()
+	}
+	if err := p.Send(&sarama.ProducerMessage{Topic: "test"}, callback); err != nil {
+		t.Errorf("Send err: %v.", err)
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Errorf("Send from callback timeout, sent: %d.", sent)
+		return
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("Close err: %v.", err)
+		return
+	}
+}
@@ -0,0 +1,317 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// 重试/死信消息的header（要求Version >= 0.11.0）
+const (
+	HeaderOriginalTopic     = "x-original-topic"     // 原topic
+	HeaderOriginalPartition = "x-original-partition" // 原分区
+	HeaderOriginalOffset    = "x-original-offset"    // 原偏移
+	HeaderError             = "x-error"              // 最后一次处理的错误
+	HeaderAttempt           = "x-attempt"            // 已失败的轮数（每个重试topic 算一轮）
+	HeaderRetryAt           = "x-retry-at"           // 重试时间（unix 毫秒）
+)
+
+// replayIdleInterval 重放时没有新消息的最短等待时间
+const replayIdleInterval = 500 * time.Millisecond
+
+// RetryTopic 第n（从1 开始）级重试topic，例如"order.retry.1"
+func RetryTopic(topic string, n int) string {
+	return topic + ".retry." + strconv.Itoa(n)
+}
+
+// DLQTopic 死信topic，例如"order.dlq"
+func DLQTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+// GroupConsumerWithRetryTopics 开启重试topic 及死信topic
+/**
+处理失败（进程内重试耗尽）后，消息依次发送到topic.retry.1 ... topic.retry.N（N 为len(delays)），
+第n 级重试topic 中的消息在失败delays[n-1] 后重新处理，最后一级仍然失败时发送到topic.dlq；
+GroupConsumer 会同时订阅原topic 及全部重试topic（需要提前创建），原topic、分区、偏移、错误及失败轮数记录在header 中。
+*/
+func GroupConsumerWithRetryTopics(delays ...time.Duration) GroupConsumerOption {
+	return func(g *GroupConsumer) {
+		g.retryTopics = true
+		g.retryDelays = delays
+	}
+}
+
+// initRetryTopics 订阅重试topic 并新建用于转发的生产者
+func (g *GroupConsumer) initRetryTopics() error {
+	if !g.retryTopics {
+		return nil
+	}
+
+	g.topicLevels = make(map[string]int)
+	topics := append([]string(nil), g.topics...)
+	for _, topic := range g.topics {
+		for n := 1; n <= len(g.retryDelays); n++ {
+			rt := RetryTopic(topic, n)
+			g.topicLevels[rt] = n
+			topics = append(topics, rt)
+		}
+	}
+	g.topics = topics
+
+	producerConfig, err := g.cfg.saramaConfig()
+	if err != nil {
+		return err
+	}
+	producerConfig.Producer.Return.Successes = true
+	producer, err := sarama.NewSyncProducer(g.cfg.Endpoints, producerConfig)
+	if err != nil {
+		return err
+	}
+	g.producer = producer
+	return nil
+}
+
+// waitRetry 重试topic 中的消息等待到重试时间，ctx 被取消时返回false
+func (g *GroupConsumer) waitRetry(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	if _, ok := g.topicLevels[msg.Topic]; !ok {
+		return true
+	}
+	retryAt, err := strconv.ParseInt(recordHeader(msg.Headers, HeaderRetryAt), 10, 64)
+	if err != nil {
+		return true
+	}
+	return sleepContext(ctx, time.Until(time.UnixMilli(retryAt)))
+}
+
+// forward 将处理失败的消息发送到下一级重试topic 或死信topic，发送失败时按退避时间重试直到ctx 被取消
+func (g *GroupConsumer) forward(ctx context.Context, msg *sarama.ConsumerMessage, handleErr error) error {
+	origin := recordHeader(msg.Headers, HeaderOriginalTopic)
+	if origin == "" {
+		origin = msg.Topic
+	}
+	attempt := g.topicLevels[msg.Topic] + 1
+
+	pm := &sarama.ProducerMessage{Value: sarama.ByteEncoder(msg.Value)}
+	if msg.Key != nil {
+		pm.Key = sarama.ByteEncoder(msg.Key)
+	}
+	if attempt <= len(g.retryDelays) {
+		pm.Topic = RetryTopic(origin, attempt)
+	} else {
+		pm.Topic = DLQTopic(origin)
+	}
+
+	for _, h := range msg.Headers {
+		if !strings.HasPrefix(string(h.Key), "x-") {
+			pm.Headers = append(pm.Headers, *h)
+		}
+	}
+	partition, offset := strconv.Itoa(int(msg.Partition)), strconv.FormatInt(msg.Offset, 10)
+	if _, ok := g.topicLevels[msg.Topic]; ok {
+		// 重试topic 中的消息保留最初的位置
+		partition, offset = recordHeader(msg.Headers, HeaderOriginalPartition), recordHeader(msg.Headers, HeaderOriginalOffset)
+	}
+	headers := map[string]string{
+		HeaderOriginalTopic:     origin,
+		HeaderOriginalPartition: partition,
+		HeaderOriginalOffset:    offset,
+		HeaderError:             handleErr.Error(),
+		HeaderAttempt:           strconv.Itoa(attempt),
+	}
+	if attempt <= len(g.retryDelays) {
+		headers[HeaderRetryAt] = strconv.FormatInt(time.Now().Add(g.retryDelays[attempt-1]).UnixMilli(), 10)
+	}
+	for k, v := range headers {
+		pm.Headers = append(pm.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+
+	backoff := g.backoff
+	for {
+		_, _, err := g.producer.SendMessage(pm)
+		if err == nil {
+			break
+		}
+		logrus.Errorf("[kafka]group '%s' forward message to '%s' err: %v, retry after %v.", g.group, pm.Topic, err, backoff)
+		if !sleepContext(ctx, backoff) {
+			return ctx.Err()
+		}
+		backoff = g.nextBackoff(backoff)
+	}
+
+	if attempt > len(g.retryDelays) {
+		g.report(fmt.Errorf("[kafka]group '%s' message topic '%s' partition %s offset %s moved to '%s', err: %w",
+			g.group, origin, partition, offset, pm.Topic, handleErr))
+	} else {
+		logrus.Warnf("[kafka]group '%s' message topic '%s' partition %s offset %s moved to '%s', err: %v.",
+			g.group, origin, partition, offset, pm.Topic, handleErr)
+	}
+	return nil
+}
+
+// recordHeader 获取header 的值，不存在时返回""
+func recordHeader(headers []*sarama.RecordHeader, key string) string {
+	for _, h := range headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// ReplayDLQ 将topic 的死信队列中的消息重新发送到原topic，返回发送的数量
+/**
+只重放调用时已存在的消息，重放进度通过消费组group 提交，重复调用不会重复发送；发送时去掉重试相关的header。
+*/
+func ReplayDLQ(ctx context.Context, cfg *Config, topic, group string) (int, error) {
+	if cfg == nil {
+		return 0, errors.New("[kafka]config is nil")
+	}
+	if topic == "" || group == "" {
+		return 0, errors.New("[kafka]topic or group is '', please check")
+	}
+
+	sc, err := cfg.saramaConfig()
+	if err != nil {
+		return 0, err
+	}
+	sc.Producer.Return.Successes = true
+	sc.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	client, err := sarama.NewClient(cfg.Endpoints, sc)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		return 0, err
+	}
+	defer producer.Close()
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+
+	om, err := sarama.NewOffsetManagerFromClient(group, client)
+	if err != nil {
+		return 0, err
+	}
+	defer om.Close()
+
+	dlq := DLQTopic(topic)
+	partitions, err := client.Partitions(dlq)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, partition := range partitions {
+		count, err := replayPartition(ctx, client, consumer, producer, om, topic, dlq, partition)
+		n += count
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// replayPartition 重放死信topic 的一个分区，直到调用时的最新偏移
+/**
+分区末尾是事务控制记录或者已被压缩时不会收到偏移为newest-1 的消息，因此一段时间内没有新消息时也会结束，
+等待时间至少为replayIdleInterval，且不小于ConsumePartition（查询偏移）耗时的2 倍，避免broker 较慢时提前结束；
+此时无法确认剩余的偏移是否都已拉取，只提交已发送的消息，不会跳过尚未拉取的消息。
+*/
+func replayPartition(ctx context.Context, client sarama.Client, consumer sarama.Consumer, producer sarama.SyncProducer,
+	om sarama.OffsetManager, topic, dlq string, partition int32) (int, error) {
+	newest, err := client.GetOffset(dlq, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, err
+	}
+
+	pom, err := om.ManagePartition(dlq, partition)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		// 先提交，否则Close 会等待下一次自动提交
+		om.Commit()
+		_ = pom.Close()
+	}()
+
+	next, _ := pom.NextOffset()
+	if next < 0 {
+		if next, err = client.GetOffset(dlq, partition, sarama.OffsetOldest); err != nil {
+			return 0, err
+		}
+	}
+	if next >= newest {
+		return 0, nil
+	}
+
+	start := time.Now()
+	pc, err := consumer.ConsumePartition(dlq, partition, next)
+	if err != nil {
+		return 0, err
+	}
+	defer pc.Close()
+
+	wait := replayIdleInterval
+	if d := 2 * time.Since(start); d > wait {
+		wait = d
+	}
+	idle := time.NewTimer(wait)
+	defer idle.Stop()
+
+	n := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case err := <-pc.Errors():
+			return n, err
+		case <-idle.C:
+			return n, nil
+		case msg := <-pc.Messages():
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+
+			origin := recordHeader(msg.Headers, HeaderOriginalTopic)
+			if origin == "" {
+				origin = topic
+			}
+			pm := &sarama.ProducerMessage{Topic: origin, Value: sarama.ByteEncoder(msg.Value)}
+			if msg.Key != nil {
+				pm.Key = sarama.ByteEncoder(msg.Key)
+			}
+			for _, h := range msg.Headers {
+				if !strings.HasPrefix(string(h.Key), "x-") {
+					pm.Headers = append(pm.Headers, *h)
+				}
+			}
+			if _, _, err := producer.SendMessage(pm); err != nil {
+				return n, err
+			}
+			pom.MarkOffset(msg.Offset+1, "")
+			n++
+
+			if msg.Offset+1 >= newest {
+				return n, nil
+			}
+			idle.Reset(wait)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/psoKnight/go-common/kafka/kafkatest"
+)
+
+func TestRetryTopicForward(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	g := &GroupConsumer{
+		group:       "test_group",
+		retryDelays: []time.Duration{time.Second, time.Minute},
+		topicLevels: map[string]int{RetryTopic("order", 1): 1, RetryTopic("order", 2): 2},
+		producer:    producer,
+		backoff:     time.Millisecond,
+		errors:      make(chan error, 1),
+	}
+
+	var forwarded *sarama.ProducerMessage
+	checker := func(msg *sarama.ProducerMessage) error {
+		forwarded = msg
+		return nil
+	}
+
+	// 原topic -> retry.1
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checker)
+	msg := &sarama.ConsumerMessage{Topic: "order", Partition: 3, Offset: 42, Value: []byte("value")}
+	if err := g.forward(context.Background(), msg, errors.New("handle err")); err != nil {
+		t.Errorf("Forward err: %v.", err)
+		return
+	}
+	if forwarded.Topic != "order.retry.1" || forwarded.Key != nil || headerValue(forwarded, HeaderAttempt) != "1" || headerValue(forwarded, HeaderRetryAt) == "" {
+		t.Errorf("Forward to retry topic unexpected: %+v.", forwarded)
+		return
+	}
+
+	// retry.2 -> dlq，保留最初的位置
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(checker)
+	msg = &sarama.ConsumerMessage{Topic: "order.retry.2", Partition: 0, Offset: 7, Headers: []*sarama.RecordHeader{
+		{Key: []byte(HeaderOriginalTopic), Value: []byte("order")},
+		{Key: []byte(HeaderOriginalPartition), Value: []byte("3")},
+		{Key: []byte(HeaderOriginalOffset), Value: []byte("42")},
+		{Key: []byte("trace-id"), Value: []byte("abc")},
+	}}
+	if err := g.forward(context.Background(), msg, errors.New("handle err")); err != nil {
+		t.Errorf("Forward err: %v.", err)
+		return
+	}
+	if forwarded.Topic != "order.dlq" || headerValue(forwarded, HeaderOriginalOffset) != "42" ||
+		headerValue(forwarded, HeaderAttempt) != "3" || headerValue(forwarded, "trace-id") != "abc" {
+		t.Errorf("Forward to dlq unexpected: %+v.", forwarded)
+		return
+	}
+	select {
+	case err := <-g.Errors():
+		t.Logf("Dlq err: %v.", err)
+	default:
+		t.Errorf("Move to dlq should report err.")
+		return
+	}
+
+	if err := producer.Close(); err != nil {
+		t.Errorf("Mock producer close err: %v.", err)
+		return
+	}
+}
+
+func TestReplayDLQ(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.CreateTopic("order", 1)
+	cluster.Seed(DLQTopic("order"), 0,
+		kafkatest.Record{Value: []byte("a"), Headers: map[string]string{HeaderOriginalTopic: "order", HeaderAttempt: "3", "trace-id": "abc"}},
+		kafkatest.Record{Value: []byte("b")},
+		kafkatest.Record{Value: []byte("c")})
+	// 末尾的消息被压缩，重放不能一直等待该偏移
+	cluster.Compact(DLQTopic("order"), 0, 2)
+	cluster.AddGroup("replay", DLQTopic("order"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	n, err := ReplayDLQ(ctx, &Config{Endpoints: cluster.Endpoints()}, "order", "replay")
+	if err != nil {
+		t.Errorf("Replay dlq err: %v.", err)
+		return
+	}
+	if n != 2 {
+		t.Errorf("Replay dlq count: %d, want 2.", n)
+		return
+	}
+
+	records := cluster.Produced("order")
+	if !kafkatest.AssertValues(t, records, "a", "b") {
+		return
+	}
+	if records[0].Headers[HeaderAttempt] != "" || records[0].Headers["trace-id"] != "abc" {
+		t.Errorf("Replay dlq headers unexpected: %v.", records[0].Headers)
+		return
+	}
+	// 无法确认被压缩的末尾是否已拉取，只提交已发送的消息
+	if offset := cluster.Committed("replay", DLQTopic("order"), 0); offset != 2 {
+		t.Errorf("Replay dlq committed offset: %d, want 2.", offset)
+		return
+	}
+}
+
+func TestReplayDLQSlowFetch(t *testing.T) {
+	cluster := kafkatest.NewCluster(t)
+	cluster.CreateTopic("order", 1)
+	cluster.SeedValues(DLQTopic("order"), 0, "a", "b", "c")
+	cluster.AddGroup("replay", DLQTopic("order"))
+
+	// 每次拉取只返回一条消息，且拉取耗时超过replayIdleInterval
+	var fetches []interface{}
+	for i, v := range []string{"a", "b", "c"} {
+		fetch := &sarama.FetchResponse{Version: 4}
+		fetch.AddRecordWithTimestamp(DLQTopic("order"), 0, nil, sarama.StringEncoder(v), int64(i), time.Now())
+		fetch.GetBlock(DLQTopic("order"), 0).HighWaterMarkOffset = 3
+		fetches = append(fetches, fetch)
+	}
+	cluster.SetHandler("FetchRequest", sarama.NewMockSequence(fetches...))
+	cluster.Broker().SetLatency(replayIdleInterval + 200*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	n, err := ReplayDLQ(ctx, &Config{Endpoints: cluster.Endpoints()}, "order", "replay")
+	if err != nil {
+		t.Errorf("Replay dlq err: %v.", err)
+		return
+	}
+	if n != 3 {
+		t.Errorf("Replay dlq count: %d, want 3.", n)
+		return
+	}
+	if !kafkatest.AssertValues(t, cluster.Produced("order"), "a", "b", "c") {
+		return
+	}
+	if offset := cluster.Committed("replay", DLQTopic("order"), 0); offset != 3 {
+		t.Errorf("Replay dlq committed offset: %d, want 3.", offset)
+		return
+	}
+}
+
+func headerValue(msg *sarama.ProducerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramClient 实现sarama.SCRAMClient 接口（RFC 5802，不进行SASLprep，用户名及密码需要为ASCII）
+type scramClient struct {
+	hash     func() hash.Hash
+	user     string
+	password string
+	authzID  string
+
+	step        int
+	nonce       string
+	clientFirst string // client-first-message-bare
+	serverSig   []byte
+	done        bool
+}
+
+// newSCRAMClientGenerator 根据SASL 机制返回SCRAM client 生成函数
+func newSCRAMClientGenerator(mechanism sarama.SASLMechanism) func() sarama.SCRAMClient {
+	h := sha256.New
+	if mechanism == sarama.SASLTypeSCRAMSHA512 {
+		h = sha512.New
+	}
+	return func() sarama.SCRAMClient {
+		return &scramClient{hash: h}
+	}
+}
+
+// scramEscaper 用户名中的','、'=' 需要转义
+var scramEscaper = strings.NewReplacer("=", "=3D", ",", "=2C")
+
+func (s *scramClient) Begin(userName, password, authzID string) error {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	s.user, s.password, s.authzID = userName, password, authzID
+	s.nonce = base64.RawStdEncoding.EncodeToString(b)
+	s.step, s.done = 0, false
+	return nil
+}
+
+func (s *scramClient) Step(challenge string) (string, error) {
+	s.step++
+	switch s.step {
+	case 1:
+		s.clientFirst = "n=" + scramEscaper.Replace(s.user) + ",r=" + s.nonce
+		return s.gs2Header() + s.clientFirst, nil
+	case 2:
+		return s.clientFinal(challenge)
+	case 3:
+		return "", s.verify(challenge)
+	default:
+		return "", errors.New("[kafka]scram unexpected step")
+	}
+}
+
+func (s *scramClient) Done() bool {
+	return s.done
+}
+
+// clientFinal 根据server-first-message 生成client-final-message
+func (s *scramClient) clientFinal(serverFirst string) (string, error) {
+	attrs := parseSCRAMAttrs(serverFirst)
+	nonce, salt64, iter := attrs["r"], attrs["s"], attrs["i"]
+	if !strings.HasPrefix(nonce, s.nonce) || len(nonce) == len(s.nonce) {
+		return "", errors.New("[kafka]scram invalid server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(salt64)
+	if err != nil {
+		return "", fmt.Errorf("[kafka]scram invalid salt: %v", err)
+	}
+	iterations, err := strconv.Atoi(iter)
+	if err != nil || iterations <= 0 {
+		return "", fmt.Errorf("[kafka]scram invalid iteration count '%s'", iter)
+	}
+
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(s.gs2Header())) + ",r=" + nonce
+	authMessage := []byte(s.clientFirst + "," + serverFirst + "," + withoutProof)
+
+	salted := pbkdf2.Key([]byte(s.password), salt, iterations, s.hash().Size(), s.hash)
+	clientKey := s.hmac(salted, []byte("Client Key"))
+	storedKey := s.hash()
+	storedKey.Write(clientKey)
+	clientSig := s.hmac(storedKey.Sum(nil), authMessage)
+
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSig[i]
+	}
+	s.serverSig = s.hmac(s.hmac(salted, []byte("Server Key")), authMessage)
+
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+// verify 校验server-final-message 中的服务端签名
+func (s *scramClient) verify(serverFinal string) error {
+	attrs := parseSCRAMAttrs(serverFinal)
+	if e, ok := attrs["e"]; ok {
+		return fmt.Errorf("[kafka]scram server error: %s", e)
+	}
+	sig, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(sig, s.serverSig) {
+		return errors.New("[kafka]scram invalid server signature")
+	}
+	s.done = true
+	return nil
+}
+
+// gs2Header 不支持channel binding
+func (s *scramClient) gs2Header() string {
+	if s.authzID == "" {
+		return "n,,"
+	}
+	return "n,a=" + scramEscaper.Replace(s.authzID) + ","
+}
+
+func (s *scramClient) hmac(key, data []byte) []byte {
+	m := hmac.New(s.hash, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// parseSCRAMAttrs 解析"k=v,k=v" 格式的消息
+func parseSCRAMAttrs(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range strings.Split(msg, ",") {
+		if len(kv) >= 2 && kv[1] == '=' {
+			attrs[kv[:1]] = kv[2:]
+		}
+	}
+	return attrs
+}
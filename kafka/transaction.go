@@ -0,0 +1,633 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrTxnFenced 相同transactional.id 的新生产者已经启动，当前生产者不能再使用
+var ErrTxnFenced = errors.New("[kafka]transactional producer is fenced")
+
+// topicPartition 分区
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// TxnProducer 事务生产者（exactly-once）
+/**
+sarama 1.36 没有提供事务API，这里基于InitProducerID/AddPartitionsToTxn/AddOffsetsToTxn/TxnOffsetCommit/EndTxn 请求实现，
+要求Kafka >= 0.11.0（Config.Version 为空时按2.0.0 协商）；消费端需要设置Config.ReadCommitted 才能只读取已提交的消息。
+事务内的Send 为同步发送；同一时间只能有一个事务，Transact 会串行执行。
+协调者不可用时按Producer.Retry 重试，ctx 被取消时停止等待并返回ctx.Err()。
+*/
+type TxnProducer struct {
+	cfg             *Config
+	sc              *sarama.Config
+	client          sarama.Client
+	transactionalID string
+
+	txnMu sync.Mutex // Transact 串行执行
+
+	mu          sync.Mutex
+	coordinator *sarama.Broker
+	groups      map[string]*sarama.Broker // 消费组协调者
+	producerID  int64
+	epoch       int16
+	sequences   map[topicPartition]int32
+	partitions  map[topicPartition]bool // 当前事务已加入的分区
+	partitioner map[string]sarama.Partitioner
+	inTxn       bool
+	fenced      bool
+}
+
+// NewTxnProducer 新建事务生产者，transactional.id 为Config.Producer.TransactionalID
+func NewTxnProducer(cfg *Config) (*TxnProducer, error) {
+	if cfg == nil {
+		return nil, errors.New("[kafka]config is nil")
+	}
+	if cfg.Producer.TransactionalID == "" {
+		return nil, errors.New("[kafka]transactional id is '', please check")
+	}
+
+	sc, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Version == "" {
+		sc.Version = sarama.V2_0_0_0
+	}
+	if !sc.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, errors.New("[kafka]transactional producer requires version >= 0.11.0")
+	}
+
+	client, err := sarama.NewClient(cfg.Endpoints, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &TxnProducer{
+		cfg:             cfg,
+		sc:              sc,
+		client:          client,
+		transactionalID: cfg.Producer.TransactionalID,
+		groups:          make(map[string]*sarama.Broker),
+		partitioner:     make(map[string]sarama.Partitioner),
+	}
+	if err := p.initProducerID(context.Background()); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// BeginTxn 开始事务
+func (p *TxnProducer) BeginTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fenced {
+		return ErrTxnFenced
+	}
+	if p.inTxn {
+		return errors.New("[kafka]transaction already begun")
+	}
+	p.inTxn = true
+	p.partitions = make(map[topicPartition]bool)
+	return nil
+}
+
+// Send 在事务中同步发送消息，失败时需要AbortTxn
+func (p *TxnProducer) Send(ctx context.Context, msgs ...*Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.checkTxn(); err != nil {
+		return err
+	}
+
+	batches := make(map[topicPartition][]*Message)
+	var order []topicPartition
+	for _, msg := range msgs {
+		if msg == nil || msg.Topic == "" {
+			return errors.New("[kafka]message is nil or topic is '', please check")
+		}
+		partition, err := p.partition(msg)
+		if err != nil {
+			return err
+		}
+		tp := topicPartition{topic: msg.Topic, partition: partition}
+		if _, ok := batches[tp]; !ok {
+			order = append(order, tp)
+		}
+		batches[tp] = append(batches[tp], msg)
+	}
+	if err := p.addPartitions(ctx, order); err != nil {
+		return err
+	}
+
+	// 按leader 合并请求
+	requests := make(map[*sarama.Broker]*sarama.ProduceRequest)
+	leaders := make(map[*sarama.Broker][]topicPartition)
+	for _, tp := range order {
+		leader, err := p.client.Leader(tp.topic, tp.partition)
+		if err != nil {
+			return err
+		}
+		req, ok := requests[leader]
+		if !ok {
+			req = &sarama.ProduceRequest{
+				TransactionalID: &p.transactionalID,
+				RequiredAcks:    sarama.WaitForAll,
+				Timeout:         int32(p.sc.Producer.Timeout / time.Millisecond),
+				Version:         3,
+			}
+			requests[leader] = req
+		}
+		req.AddBatch(tp.topic, tp.partition, p.recordBatch(tp, batches[tp]))
+		leaders[leader] = append(leaders[leader], tp)
+	}
+
+	for broker, req := range requests {
+		resp, err := broker.Produce(req)
+		if err != nil {
+			return err
+		}
+		for _, tp := range leaders[broker] {
+			block := resp.GetBlock(tp.topic, tp.partition)
+			if block == nil {
+				return fmt.Errorf("[kafka]produce '%s' partition %d no response", tp.topic, tp.partition)
+			}
+			if block.Err != sarama.ErrNoError {
+				return p.checkFenced(block.Err)
+			}
+			p.sequences[tp] += int32(len(batches[tp]))
+		}
+	}
+	return nil
+}
+
+// AddOffsetsToTxn 在事务中提交消费组的偏移（offsets 为下一条需要消费的偏移）
+func (p *TxnProducer) AddOffsetsToTxn(ctx context.Context, offsets map[string]map[int32]int64, groupID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.checkTxn(); err != nil {
+		return err
+	}
+
+	err := p.coordinatorDo(ctx, func(b *sarama.Broker) (sarama.KError, error) {
+		resp, err := b.AddOffsetsToTxn(&sarama.AddOffsetsToTxnRequest{
+			TransactionalID: p.transactionalID,
+			ProducerID:      p.producerID,
+			ProducerEpoch:   p.epoch,
+			GroupID:         groupID,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return resp.Err, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	req := &sarama.TxnOffsetCommitRequest{
+		TransactionalID: p.transactionalID,
+		GroupID:         groupID,
+		ProducerID:      p.producerID,
+		ProducerEpoch:   p.epoch,
+		Topics:          make(map[string][]*sarama.PartitionOffsetMetadata),
+	}
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			req.Topics[topic] = append(req.Topics[topic], &sarama.PartitionOffsetMetadata{Partition: partition, Offset: offset})
+		}
+	}
+	return p.retry(ctx, func() (sarama.KError, error) {
+		coordinator := p.groups[groupID]
+		if coordinator == nil {
+			var err error
+			if coordinator, err = p.findCoordinator(groupID, sarama.CoordinatorGroup); err != nil {
+				return 0, err
+			}
+			p.groups[groupID] = coordinator
+		}
+
+		resp, err := coordinator.TxnOffsetCommit(req)
+		if err != nil {
+			delete(p.groups, groupID)
+			return 0, err
+		}
+		for _, errs := range resp.Topics {
+			for _, e := range errs {
+				if e.Err != sarama.ErrNoError {
+					if isCoordinatorErr(e.Err) {
+						delete(p.groups, groupID)
+					}
+					return e.Err, nil
+				}
+			}
+		}
+		return sarama.ErrNoError, nil
+	})
+}
+
+// CommitTxn 提交事务
+func (p *TxnProducer) CommitTxn(ctx context.Context) error {
+	return p.endTxn(ctx, true)
+}
+
+// AbortTxn 回滚事务，并重新初始化producer id（重置序列号）
+func (p *TxnProducer) AbortTxn(ctx context.Context) error {
+	return p.endTxn(ctx, false)
+}
+
+// Transact 在事务中执行fn，fn 返回错误时回滚，否则提交
+/**
+ctx 被取消时回滚可能没有完成，下一次Transact 会先回滚上一个事务。
+*/
+func (p *TxnProducer) Transact(ctx context.Context, fn func() error) error {
+	p.txnMu.Lock()
+	defer p.txnMu.Unlock()
+
+	p.mu.Lock()
+	pending := p.inTxn && !p.fenced
+	p.mu.Unlock()
+	if pending {
+		if err := p.AbortTxn(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := p.BeginTxn(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		p.abort(ctx, err)
+		return err
+	}
+	if err := p.CommitTxn(ctx); err != nil {
+		p.abort(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// abort 执行失败后回滚，已被fence 时不再回滚
+func (p *TxnProducer) abort(ctx context.Context, err error) {
+	if errors.Is(err, ErrTxnFenced) {
+		return
+	}
+	if abortErr := p.AbortTxn(ctx); abortErr != nil {
+		logrus.Errorf("[kafka]transactional id '%s' abort err: %v.", p.transactionalID, abortErr)
+	}
+}
+
+// Close 回滚未完成的事务并关闭
+func (p *TxnProducer) Close() error {
+	p.mu.Lock()
+	inTxn := p.inTxn && !p.fenced
+	p.mu.Unlock()
+
+	if inTxn {
+		if err := p.AbortTxn(context.Background()); err != nil {
+			logrus.Errorf("[kafka]transactional id '%s' abort err: %v.", p.transactionalID, err)
+		}
+	}
+	return p.client.Close()
+}
+
+// endTxn 结束事务
+func (p *TxnProducer) endTxn(ctx context.Context, commit bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.checkTxn(); err != nil {
+		return err
+	}
+
+	err := p.coordinatorDo(ctx, func(b *sarama.Broker) (sarama.KError, error) {
+		resp, err := b.EndTxn(&sarama.EndTxnRequest{
+			TransactionalID:   p.transactionalID,
+			ProducerID:        p.producerID,
+			ProducerEpoch:     p.epoch,
+			TransactionResult: commit,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return resp.Err, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	p.inTxn = false
+	if !commit {
+		// 回滚后发送失败的序列号不再可信，提升epoch 重新开始
+		return p.initProducerIDLocked(ctx)
+	}
+	return nil
+}
+
+// initProducerID 获取producer id 及epoch，并重置序列号
+func (p *TxnProducer) initProducerID(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.initProducerIDLocked(ctx)
+}
+
+func (p *TxnProducer) initProducerIDLocked(ctx context.Context) error {
+	return p.coordinatorDo(ctx, func(b *sarama.Broker) (sarama.KError, error) {
+		resp, err := b.InitProducerID(&sarama.InitProducerIDRequest{
+			TransactionalID:    &p.transactionalID,
+			TransactionTimeout: p.sc.Producer.Timeout * 6,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if resp.Err == sarama.ErrNoError {
+			p.producerID, p.epoch = resp.ProducerID, resp.ProducerEpoch
+			p.sequences = make(map[topicPartition]int32)
+		}
+		return resp.Err, nil
+	})
+}
+
+// addPartitions 将分区加入事务
+func (p *TxnProducer) addPartitions(ctx context.Context, tps []topicPartition) error {
+	req := &sarama.AddPartitionsToTxnRequest{
+		TransactionalID: p.transactionalID,
+		ProducerID:      p.producerID,
+		ProducerEpoch:   p.epoch,
+		TopicPartitions: make(map[string][]int32),
+	}
+	for _, tp := range tps {
+		if !p.partitions[tp] {
+			req.TopicPartitions[tp.topic] = append(req.TopicPartitions[tp.topic], tp.partition)
+		}
+	}
+	if len(req.TopicPartitions) == 0 {
+		return nil
+	}
+
+	err := p.coordinatorDo(ctx, func(b *sarama.Broker) (sarama.KError, error) {
+		resp, err := b.AddPartitionsToTxn(req)
+		if err != nil {
+			return 0, err
+		}
+		for _, errs := range resp.Errors {
+			for _, e := range errs {
+				if e.Err != sarama.ErrNoError {
+					return e.Err, nil
+				}
+			}
+		}
+		return sarama.ErrNoError, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, tp := range tps {
+		p.partitions[tp] = true
+	}
+	return nil
+}
+
+// partition 根据配置的分区方式选择分区
+func (p *TxnProducer) partition(msg *Message) (int32, error) {
+	partitions, err := p.client.Partitions(msg.Topic)
+	if err != nil {
+		return 0, err
+	}
+	if len(partitions) == 0 {
+		return 0, fmt.Errorf("[kafka]topic '%s' has no partition", msg.Topic)
+	}
+
+	partitioner, ok := p.partitioner[msg.Topic]
+	if !ok {
+		partitioner = p.sc.Producer.Partitioner(msg.Topic)
+		p.partitioner[msg.Topic] = partitioner
+	}
+	idx, err := partitioner.Partition(msg.ProducerMessage(), int32(len(partitions)))
+	if err != nil {
+		return 0, err
+	}
+	if idx < 0 || int(idx) >= len(partitions) {
+		return 0, fmt.Errorf("[kafka]topic '%s' invalid partition %d", msg.Topic, idx)
+	}
+	return partitions[idx], nil
+}
+
+// recordBatch 生成事务消息批次
+func (p *TxnProducer) recordBatch(tp topicPartition, msgs []*Message) *sarama.RecordBatch {
+	now := time.Now()
+	first := msgs[0].Timestamp
+	if first.IsZero() {
+		first = now
+	}
+
+	batch := &sarama.RecordBatch{
+		Version:          2,
+		Codec:            p.sc.Producer.Compression,
+		CompressionLevel: p.sc.Producer.CompressionLevel,
+		FirstTimestamp:   first,
+		MaxTimestamp:     first,
+		ProducerID:       p.producerID,
+		ProducerEpoch:    p.epoch,
+		FirstSequence:    p.sequences[tp],
+		IsTransactional:  true,
+		LastOffsetDelta:  int32(len(msgs) - 1),
+	}
+	for i, msg := range msgs {
+		ts := msg.Timestamp
+		if ts.IsZero() {
+			ts = now
+		}
+		if ts.After(batch.MaxTimestamp) {
+			batch.MaxTimestamp = ts
+		}
+		record := &sarama.Record{OffsetDelta: int64(i), TimestampDelta: ts.Sub(first), Key: msg.Key, Value: msg.Value}
+		for k, v := range msg.Headers {
+			record.Headers = append(record.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+		}
+		batch.Records = append(batch.Records, record)
+	}
+	return batch
+}
+
+// coordinatorDo 向事务协调者发送请求，协调者变化或繁忙时重试
+func (p *TxnProducer) coordinatorDo(ctx context.Context, do func(b *sarama.Broker) (sarama.KError, error)) error {
+	return p.retry(ctx, func() (sarama.KError, error) {
+		if p.coordinator == nil {
+			coordinator, err := p.findCoordinator(p.transactionalID, sarama.CoordinatorTransaction)
+			if err != nil {
+				return 0, err
+			}
+			p.coordinator = coordinator
+		}
+
+		kerr, err := do(p.coordinator)
+		if err != nil || isCoordinatorErr(kerr) {
+			p.coordinator = nil
+		}
+		return kerr, err
+	})
+}
+
+// findCoordinator 查找事务或消费组的协调者
+/**
+统一使用FindCoordinator v1（事务协调者要求v1），消费组协调者也不经过client 的缓存。
+*/
+func (p *TxnProducer) findCoordinator(key string, coordinatorType sarama.CoordinatorType) (*sarama.Broker, error) {
+	var lastErr error
+	for _, b := range p.client.Brokers() {
+		_ = b.Open(p.sc)
+		resp, err := b.FindCoordinator(&sarama.FindCoordinatorRequest{
+			Version:         1,
+			CoordinatorKey:  key,
+			CoordinatorType: coordinatorType,
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.Err != sarama.ErrNoError {
+			lastErr = resp.Err
+			continue
+		}
+		coordinator, err := p.client.Broker(resp.Coordinator.ID())
+		if err != nil {
+			// 协调者不在已知的broker 中，刷新元数据后重试
+			if err = p.client.RefreshMetadata(); err == nil {
+				coordinator, err = p.client.Broker(resp.Coordinator.ID())
+			}
+		}
+		return coordinator, err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("[kafka]no available broker")
+	}
+	return nil, lastErr
+}
+
+// retry 重试可恢复的错误，ctx 被取消时返回ctx.Err()
+func (p *TxnProducer) retry(ctx context.Context, do func() (sarama.KError, error)) error {
+	backoff := p.sc.Producer.Retry.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		kerr, err := do()
+		if err == nil && kerr == sarama.ErrNoError {
+			return nil
+		}
+		if err == nil {
+			err = p.checkFenced(kerr)
+			if !isCoordinatorErr(kerr) && kerr != sarama.ErrConcurrentTransactions {
+				return err
+			}
+		}
+		if attempt >= p.sc.Producer.Retry.Max {
+			return err
+		}
+		if !sleepContext(ctx, backoff) {
+			return ctx.Err()
+		}
+	}
+}
+
+// checkTxn 检查是否在事务中
+func (p *TxnProducer) checkTxn() error {
+	if p.fenced {
+		return ErrTxnFenced
+	}
+	if !p.inTxn {
+		return errors.New("[kafka]transaction not begun")
+	}
+	return nil
+}
+
+// checkFenced epoch 过期时标记为不可用
+func (p *TxnProducer) checkFenced(kerr sarama.KError) error {
+	if kerr == sarama.ErrInvalidProducerEpoch || kerr == sarama.ErrTransactionalIDAuthorizationFailed {
+		p.fenced = true
+		return fmt.Errorf("%w: %v", ErrTxnFenced, kerr)
+	}
+	return kerr
+}
+
+// isCoordinatorErr 协调者变化或未就绪
+func isCoordinatorErr(kerr sarama.KError) bool {
+	return kerr == sarama.ErrNotCoordinatorForConsumer || kerr == sarama.ErrConsumerCoordinatorNotAvailable ||
+		kerr == sarama.ErrOffsetsLoadInProgress
+}
+
+// TransformFunc 将消费的消息转换为需要发送的消息
+type TransformFunc func(ctx context.Context, msg *sarama.ConsumerMessage) ([]*Message, error)
+
+// NewTransactionalConsumer 新建consume-transform-produce 消费者
+/**
+每条消息的转换结果与该消息的偏移在同一个事务中提交，失败时回滚并按GroupConsumer 的配置重试；消费时只读取已提交的消息。
+1. 偏移只通过事务提交，不会再自动提交，重试耗尽被跳过的消息由之后消息的事务提交偏移；
+2. 生产者被fence（ErrTxnFenced）时停止消费，Run 返回该错误，已消费的消息不会标记；
+3. cfg.Producer.TransactionalID 在同一个消费组的实例间需要唯一且保持不变。注意sarama 1.36 的TxnOffsetCommit
+   不携带消费组generation（KIP-447 之前的协议），rebalance 后分区转移到其他实例时，旧实例正在进行的事务仍可能提交，
+   此时不能保证exactly-once，需要下游能够容忍重复；
+4. 不支持GroupConsumerWithConcurrency（并发提交事务会越过未处理完成的消息）。
+*/
+func NewTransactionalConsumer(cfg *Config, group string, topics []string, transform TransformFunc, options ...GroupConsumerOption) (*GroupConsumer, error) {
+	if transform == nil {
+		return nil, errors.New("[kafka]transform is nil")
+	}
+	if cfg == nil {
+		return nil, errors.New("[kafka]config is nil")
+	}
+
+	c := *cfg
+	c.ReadCommitted = true
+	if c.Version == "" {
+		c.Version = sarama.V2_0_0_0.String()
+	}
+
+	txn, err := NewTxnProducer(&c)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return txn.Transact(ctx, func() error {
+			out, err := transform(ctx, msg)
+			if err != nil {
+				return err
+			}
+			if len(out) > 0 {
+				if err := txn.Send(ctx, out...); err != nil {
+					return err
+				}
+			}
+			return txn.AddOffsetsToTxn(ctx, map[string]map[int32]int64{msg.Topic: {msg.Partition: msg.Offset + 1}}, group)
+		})
+	}
+
+	options = append(options[:len(options):len(options)], func(g *GroupConsumer) {
+		g.txn = txn
+	})
+	g, err := NewGroupConsumer(&c, group, topics, handler, options...)
+	if err != nil {
+		_ = txn.Close()
+		return nil, err
+	}
+	if g.workers > 1 {
+		_ = g.Close()
+		return nil, errors.New("[kafka]transactional consumer does not support concurrency")
+	}
+	return g, nil
+}
@@ -0,0 +1,261 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/psoKnight/go-common/kafka/kafkatest"
+)
+
+func newTestTxnProducer() *TxnProducer {
+	return &TxnProducer{
+		sc:              sarama.NewConfig(),
+		transactionalID: "test-txn",
+		producerID:      1000,
+		epoch:           3,
+		sequences:       make(map[topicPartition]int32),
+		partitioner:     make(map[string]sarama.Partitioner),
+	}
+}
+
+func TestTxnProducerState(t *testing.T) {
+	p := newTestTxnProducer()
+
+	if err := p.CommitTxn(context.Background()); err == nil {
+		t.Errorf("commit without begin should fail.")
+		return
+	}
+	if err := p.Send(context.Background(), &Message{Topic: "test"}); err == nil {
+		t.Errorf("send without begin should fail.")
+		return
+	}
+
+	if err := p.BeginTxn(); err != nil {
+		t.Errorf("begin txn err: %v.", err)
+		return
+	}
+	if err := p.BeginTxn(); err == nil {
+		t.Errorf("begin txn twice should fail.")
+		return
+	}
+	if err := p.Send(context.Background(), nil); err == nil {
+		t.Errorf("send nil message should fail.")
+		return
+	}
+
+	if err := p.checkFenced(sarama.ErrInvalidProducerEpoch); !errors.Is(err, ErrTxnFenced) {
+		t.Errorf("invalid producer epoch err: %v, want ErrTxnFenced.", err)
+		return
+	}
+	if err := p.BeginTxn(); !errors.Is(err, ErrTxnFenced) {
+		t.Errorf("fenced begin txn err: %v, want ErrTxnFenced.", err)
+		return
+	}
+	if err := p.AbortTxn(context.Background()); !errors.Is(err, ErrTxnFenced) {
+		t.Errorf("fenced abort txn err: %v, want ErrTxnFenced.", err)
+		return
+	}
+}
+
+func TestTxnProducerRecordBatch(t *testing.T) {
+	p := newTestTxnProducer()
+	tp := topicPartition{topic: "test", partition: 1}
+	p.sequences[tp] = 5
+
+	ts := time.Now().Add(-time.Minute)
+	msgs := []*Message{
+		{Topic: "test", Key: []byte("k1"), Value: []byte("v1"), Timestamp: ts},
+		{Topic: "test", Key: []byte("k2"), Value: []byte("v2"), Headers: map[string]string{"h": "v"}},
+	}
+	batch := p.recordBatch(tp, msgs)
+
+	if !batch.IsTransactional || batch.ProducerID != 1000 || batch.ProducerEpoch != 3 || batch.FirstSequence != 5 {
+		t.Errorf("batch transactional: %v, producer id: %d, epoch: %d, first sequence: %d.",
+			batch.IsTransactional, batch.ProducerID, batch.ProducerEpoch, batch.FirstSequence)
+		return
+	}
+	if batch.LastOffsetDelta != 1 || len(batch.Records) != 2 {
+		t.Errorf("batch last offset delta: %d, records: %d.", batch.LastOffsetDelta, len(batch.Records))
+		return
+	}
+	if !batch.FirstTimestamp.Equal(ts) || !batch.MaxTimestamp.After(ts) {
+		t.Errorf("batch first timestamp: %v, max timestamp: %v.", batch.FirstTimestamp, batch.MaxTimestamp)
+		return
+	}
+	r := batch.Records[1]
+	if r.OffsetDelta != 1 || r.TimestampDelta <= 0 || string(r.Key) != "k2" || len(r.Headers) != 1 || string(r.Headers[0].Value) != "v" {
+		t.Errorf("record offset delta: %d, timestamp delta: %v, key: %s, headers: %v.", r.OffsetDelta, r.TimestampDelta, r.Key, r.Headers)
+		return
+	}
+}
+
+// newTxnCluster 新建支持事务请求的内存集群，InitProducerID 依次返回epoch 0、1、2...
+func newTxnCluster(t *testing.T) *kafkatest.Cluster {
+	cluster := kafkatest.NewCluster(t)
+	cluster.CreateTopic("out", 1)
+
+	// 事务协调者使用FindCoordinator v1，需要带broker id 的协调者
+	client, err := sarama.NewClient(cluster.Endpoints(), nil)
+	if err != nil {
+		t.Fatalf("new client err: %v.", err)
+	}
+	coordinator, err := client.Broker(cluster.Broker().BrokerID())
+	if err != nil {
+		t.Fatalf("get broker err: %v.", err)
+	}
+	_ = client.Close()
+
+	var inits []interface{}
+	for epoch := int16(0); epoch < 5; epoch++ {
+		inits = append(inits, &sarama.InitProducerIDResponse{ProducerID: 1000, ProducerEpoch: epoch})
+	}
+	cluster.SetHandler("FindCoordinatorRequest", sarama.NewMockWrapper(&sarama.FindCoordinatorResponse{Version: 1, Coordinator: coordinator}))
+	cluster.SetHandler("InitProducerIDRequest", sarama.NewMockSequence(inits...))
+	cluster.SetHandler("AddPartitionsToTxnRequest", sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{}))
+	cluster.SetHandler("AddOffsetsToTxnRequest", sarama.NewMockWrapper(&sarama.AddOffsetsToTxnResponse{}))
+	cluster.SetHandler("TxnOffsetCommitRequest", sarama.NewMockWrapper(&sarama.TxnOffsetCommitResponse{}))
+	cluster.SetHandler("EndTxnRequest", sarama.NewMockWrapper(&sarama.EndTxnResponse{}))
+	return cluster
+}
+
+// endTxnRequests 获取EndTxn 请求
+func endTxnRequests(cluster *kafkatest.Cluster) []*sarama.EndTxnRequest {
+	var reqs []*sarama.EndTxnRequest
+	for _, rr := range cluster.Broker().History() {
+		if req, ok := rr.Request.(*sarama.EndTxnRequest); ok {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+func TestTxnProducerTransact(t *testing.T) {
+	cluster := newTxnCluster(t)
+	ctx := context.Background()
+
+	p, err := NewTxnProducer(&Config{Endpoints: cluster.Endpoints(), Version: kafkatest.Version,
+		Producer: ProducerConfig{TransactionalID: "test-txn"}})
+	if err != nil {
+		t.Errorf("new txn producer err: %v.", err)
+		return
+	}
+	defer p.Close()
+
+	// 提交：两次Send 的序列号连续
+	err = p.Transact(ctx, func() error {
+		if err := p.Send(ctx, &Message{Topic: "out", Value: []byte("a")}, &Message{Topic: "out", Value: []byte("b")}); err != nil {
+			return err
+		}
+		if err := p.Send(ctx, &Message{Topic: "out", Value: []byte("c")}); err != nil {
+			return err
+		}
+		return p.AddOffsetsToTxn(ctx, map[string]map[int32]int64{"in": {0: 5}}, "group")
+	})
+	if err != nil {
+		t.Errorf("transact err: %v.", err)
+		return
+	}
+
+	// 回滚：epoch 提升，序列号重置
+	abortErr := errors.New("abort")
+	err = p.Transact(ctx, func() error {
+		if err := p.Send(ctx, &Message{Topic: "out", Value: []byte("d")}); err != nil {
+			return err
+		}
+		return abortErr
+	})
+	if err != abortErr {
+		t.Errorf("transact abort err: %v.", err)
+		return
+	}
+	if err := p.Transact(ctx, func() error {
+		return p.Send(ctx, &Message{Topic: "out", Value: []byte("e")})
+	}); err != nil {
+		t.Errorf("transact after abort err: %v.", err)
+		return
+	}
+
+	batches := cluster.ProducedBatches("out")
+	want := []struct {
+		epoch    int16
+		sequence int32
+		records  int
+	}{{0, 0, 2}, {0, 2, 1}, {0, 3, 1}, {1, 0, 1}}
+	if len(batches) != len(want) {
+		t.Errorf("produced batches: %+v.", batches)
+		return
+	}
+	for i, w := range want {
+		b := batches[i]
+		if !b.Transactional || b.ProducerID != 1000 || b.ProducerEpoch != w.epoch || b.FirstSequence != w.sequence || len(b.Records) != w.records {
+			t.Errorf("batch %d: %+v, want epoch %d, sequence %d, records %d.", i, b, w.epoch, w.sequence, w.records)
+			return
+		}
+	}
+
+	ends := endTxnRequests(cluster)
+	if len(ends) != 3 || !ends[0].TransactionResult || ends[1].TransactionResult || !ends[2].TransactionResult ||
+		ends[0].ProducerEpoch != 0 || ends[1].ProducerEpoch != 0 || ends[2].ProducerEpoch != 1 {
+		t.Errorf("end txn requests: %+v.", ends)
+		return
+	}
+	for _, rr := range cluster.Broker().History() {
+		if req, ok := rr.Request.(*sarama.TxnOffsetCommitRequest); ok {
+			if req.GroupID != "group" || len(req.Topics["in"]) != 1 || req.Topics["in"][0].Offset != 5 || req.ProducerEpoch != 0 {
+				t.Errorf("txn offset commit request: %+v.", req)
+				return
+			}
+		}
+	}
+
+	// epoch 过期：fence 后不能再使用，也不再回滚
+	cluster.SetProduceError("out", 0, sarama.ErrInvalidProducerEpoch)
+	err = p.Transact(ctx, func() error {
+		return p.Send(ctx, &Message{Topic: "out", Value: []byte("f")})
+	})
+	if !errors.Is(err, ErrTxnFenced) {
+		t.Errorf("transact fenced err: %v, want ErrTxnFenced.", err)
+		return
+	}
+	if err := p.Transact(ctx, func() error { return nil }); !errors.Is(err, ErrTxnFenced) {
+		t.Errorf("transact after fenced err: %v, want ErrTxnFenced.", err)
+		return
+	}
+	if n := len(endTxnRequests(cluster)); n != 3 {
+		t.Errorf("fenced producer should not end txn, end txn requests: %d.", n)
+		return
+	}
+}
+
+func TestTxnProducerRetryContext(t *testing.T) {
+	cluster := newTxnCluster(t)
+
+	p, err := NewTxnProducer(&Config{Endpoints: cluster.Endpoints(), Version: kafkatest.Version,
+		Producer: ProducerConfig{TransactionalID: "test-txn", RetryMax: 1000}})
+	if err != nil {
+		t.Errorf("new txn producer err: %v.", err)
+		return
+	}
+	defer p.Close()
+
+	// 协调者一直繁忙，ctx 超时后立即返回，不会等待全部重试
+	cluster.SetHandler("EndTxnRequest", sarama.NewMockWrapper(&sarama.EndTxnResponse{Err: sarama.ErrConcurrentTransactions}))
+	// Close 时恢复，使回滚可以完成
+	defer cluster.SetHandler("EndTxnRequest", sarama.NewMockWrapper(&sarama.EndTxnResponse{}))
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = p.Transact(ctx, func() error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Errorf("transact err: %v, want context.DeadlineExceeded.", err)
+		return
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("transact should return after ctx done, took %v.", d)
+		return
+	}
+}
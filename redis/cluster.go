@@ -0,0 +1,654 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// clusterSlots Redis Cluster 哈希槽数量
+const clusterSlots = 16384
+
+// defaultMaxRedirects 默认最大MOVED/ASK 重定向次数
+const defaultMaxRedirects = 3
+
+// cluster Redis Cluster 客户端，维护槽位映射以及每个节点的连接池
+type cluster struct {
+	cfg *RedisConfig
+
+	mu         sync.RWMutex
+	slots      [clusterSlots][]string // 槽位对应的节点地址，第一个为master，其余为replica
+	pools      map[string]*redis.Pool // 节点地址 -> 连接池
+	refreshing int32                  // 是否正在刷新拓扑
+	closed     bool
+}
+
+// newCluster 新建cluster 并拉取槽位映射
+func newCluster(cfg *RedisConfig) (*cluster, error) {
+	if len(cfg.Address) == 0 {
+		return nil, errors.New("[redis]cluster address is empty")
+	}
+	if cfg.DatabaseId != 0 {
+		return nil, errors.New("[redis]cluster mode only supports database 0")
+	}
+
+	c := &cluster{
+		cfg:   cfg,
+		pools: make(map[string]*redis.Pool),
+	}
+	if err := c.refresh(); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// refresh 通过CLUSTER SLOTS 刷新槽位映射
+/**
+依次尝试已知节点及启动节点，任意一个成功即可。
+*/
+func (c *cluster) refresh() error {
+	var lastErr error
+	for _, addr := range c.knownAddrs() {
+		slots, err := c.fetchSlots(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		c.setSlots(slots)
+		return nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("[redis]no cluster node available")
+	}
+	return fmt.Errorf("[redis]refresh cluster slots err: %v", lastErr)
+}
+
+// setSlots 替换槽位映射，并关闭已不在槽位映射中（也不是启动节点）的节点连接池
+/**
+正在使用的连接在归还时关闭，之后再访问该节点（例如MOVED 重定向）会重新新建连接池。
+*/
+func (c *cluster) setSlots(slots [clusterSlots][]string) {
+	used := make(map[string]bool)
+	for i := range slots {
+		for _, addr := range slots[i] {
+			used[addr] = true
+		}
+	}
+	for _, addr := range c.cfg.Address {
+		used[addr] = true
+	}
+
+	stale := make([]*redis.Pool, 0)
+	c.mu.Lock()
+	c.slots = slots
+	for addr, p := range c.pools {
+		if !used[addr] {
+			stale = append(stale, p)
+			delete(c.pools, addr)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, p := range stale {
+		_ = p.Close()
+	}
+}
+
+// asyncRefresh 异步刷新槽位映射，同一时刻只允许一个刷新任务
+func (c *cluster) asyncRefresh() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		_ = c.refresh()
+	}()
+}
+
+// fetchSlots 从指定节点获取槽位映射
+func (c *cluster) fetchSlots(addr string) ([clusterSlots][]string, error) {
+	var slots [clusterSlots][]string
+
+	conn, err := c.getConnByAddr(addr)
+	if err != nil {
+		return slots, err
+	}
+	defer conn.Close()
+
+	values, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return slots, err
+	}
+
+	for _, v := range values {
+		/**
+		每个元素格式：[start, end, [master_ip, master_port, id], [replica_ip, replica_port, id]...]
+		*/
+		item, err := redis.Values(v, nil)
+		if err != nil {
+			return slots, err
+		}
+		if len(item) < 3 {
+			return slots, errors.New("[redis]invalid cluster slots reply")
+		}
+
+		start, err := redis.Int(item[0], nil)
+		if err != nil {
+			return slots, err
+		}
+		end, err := redis.Int(item[1], nil)
+		if err != nil {
+			return slots, err
+		}
+
+		nodes := make([]string, 0, len(item)-2)
+		for _, n := range item[2:] {
+			node, err := redis.Values(n, nil)
+			if err != nil || len(node) < 2 {
+				return slots, errors.New("[redis]invalid cluster slots node")
+			}
+			ip, err := redis.String(node[0], nil)
+			if err != nil {
+				return slots, err
+			}
+			port, err := redis.Int(node[1], nil)
+			if err != nil {
+				return slots, err
+			}
+			// 节点未声明ip 时，使用当前连接的地址
+			if ip == "" {
+				ip = strings.Split(addr, ":")[0]
+			}
+			nodes = append(nodes, ip+":"+strconv.Itoa(port))
+		}
+
+		for i := start; i <= end && i < clusterSlots; i++ {
+			slots[i] = nodes
+		}
+	}
+
+	return slots, nil
+}
+
+// knownAddrs 获取全部已知节点地址（master 优先，随后为启动节点）
+func (c *cluster) knownAddrs() []string {
+	seen := make(map[string]bool)
+	addrs := make([]string, 0)
+
+	c.mu.RLock()
+	for i := range c.slots {
+		if len(c.slots[i]) > 0 && !seen[c.slots[i][0]] {
+			seen[c.slots[i][0]] = true
+			addrs = append(addrs, c.slots[i][0])
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, addr := range c.cfg.Address {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// masters 获取全部master 节点地址
+func (c *cluster) masters() []string {
+	seen := make(map[string]bool)
+	addrs := make([]string, 0)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for i := range c.slots {
+		if len(c.slots[i]) > 0 && !seen[c.slots[i][0]] {
+			seen[c.slots[i][0]] = true
+			addrs = append(addrs, c.slots[i][0])
+		}
+	}
+	return addrs
+}
+
+// addrBySlot 根据槽位获取master 地址，槽位未知时随机返回一个已知节点
+func (c *cluster) addrBySlot(slot int) string {
+	c.mu.RLock()
+	nodes := c.slots[slot]
+	c.mu.RUnlock()
+
+	if len(nodes) > 0 {
+		return nodes[0]
+	}
+
+	addrs := c.knownAddrs()
+	return addrs[rand.Intn(len(addrs))]
+}
+
+// getPool 获取节点连接池，不存在时新建
+func (c *cluster) getPool(addr string) (*redis.Pool, error) {
+	c.mu.RLock()
+	p, ok := c.pools[addr]
+	closed := c.closed
+	c.mu.RUnlock()
+	if closed {
+		return nil, errors.New("[redis]cluster is closed")
+	}
+	if ok {
+		return p, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pools[addr]; ok {
+		return p, nil
+	}
+
+	cfg := c.cfg
+	p = &redis.Pool{
+		MaxIdle:     cfg.MaxIdle,
+		MaxActive:   cfg.MaxActive,
+		IdleTimeout: cfg.IdleTimeout,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return dialNode(ctx, cfg, addr)
+		},
+	}
+	c.pools[addr] = p
+	return p, nil
+}
+
+// getConnByAddr 根据节点地址获取连接
+func (c *cluster) getConnByAddr(addr string) (redis.Conn, error) {
+	return c.getConnByAddrContext(context.Background(), addr)
+}
+
+// getConnByAddrContext 根据节点地址获取连接，等待连接池时可通过ctx 取消
+func (c *cluster) getConnByAddrContext(ctx context.Context, addr string) (redis.Conn, error) {
+	p, err := c.getPool(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Err(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// get 获取cluster 连接，首次执行命令时根据key 绑定节点
+func (c *cluster) get() redis.Conn {
+	return &clusterConn{cluster: c, ctx: context.Background()}
+}
+
+// getContext 获取cluster 连接，获取节点连接时可通过ctx 取消
+func (c *cluster) getContext(ctx context.Context) redis.Conn {
+	return &clusterConn{cluster: c, ctx: ctx}
+}
+
+// close 关闭全部节点连接池
+func (c *cluster) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for addr, p := range c.pools {
+		_ = p.Close()
+		delete(c.pools, addr)
+	}
+}
+
+// clusterConn 实现redis.Conn，按照key 所在槽位路由命令，并处理MOVED/ASK 重定向
+/**
+Do/Send 根据命令的key 选择节点；
+pipeline（Send/Flush/Receive）中的后续命令会沿用首个命令所在节点，pipeline 中的命令需要位于同一槽位（可使用hash tag，例如"{user}:a"、"{user}:b"）。
+*/
+type clusterConn struct {
+	cluster *cluster
+	ctx     context.Context // 获取节点连接时使用的ctx
+
+	conn    redis.Conn // 当前绑定的节点连接
+	addr    string     // 当前绑定的节点地址
+	pending int        // pipeline 中未接收的回复数量
+	err     error
+}
+
+// route 根据命令的key 绑定节点，命令不包含key 时沿用当前节点
+func (cc *clusterConn) route(commandName string, args []interface{}) error {
+	key, ok := commandKey(commandName, args)
+	if !ok {
+		if cc.conn != nil {
+			return nil
+		}
+		return cc.bind(cc.cluster.addrBySlot(rand.Intn(clusterSlots)))
+	}
+	return cc.bind(cc.cluster.addrBySlot(keySlot(key)))
+}
+
+// bind 绑定到指定节点
+func (cc *clusterConn) bind(addr string) error {
+	if cc.conn != nil && cc.addr == addr {
+		return nil
+	}
+	if cc.conn != nil {
+		_ = cc.conn.Close()
+		cc.conn = nil
+	}
+
+	conn, err := cc.cluster.getConnByAddrContext(cc.ctx, addr)
+	if err != nil {
+		// 节点不可用时拓扑可能已经变化
+		cc.cluster.asyncRefresh()
+		return err
+	}
+	cc.conn = conn
+	cc.addr = addr
+	return nil
+}
+
+// Do 执行命令，遇到MOVED/ASK 时重定向
+func (cc *clusterConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return cc.do(func(c redis.Conn) (interface{}, error) {
+		return c.Do(commandName, args...)
+	}, commandName, args)
+}
+
+// DoContext 实现redis.ConnWithContext，ctx 取消时立即返回
+func (cc *clusterConn) DoContext(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	return cc.do(func(c redis.Conn) (interface{}, error) {
+		return redis.DoContext(c, ctx, commandName, args...)
+	}, commandName, args)
+}
+
+// DoWithTimeout 实现redis.ConnWithTimeout
+func (cc *clusterConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return cc.do(func(c redis.Conn) (interface{}, error) {
+		return redis.DoWithTimeout(c, timeout, commandName, args...)
+	}, commandName, args)
+}
+
+// do 在key 所在节点上执行命令，遇到MOVED/ASK 时重定向
+func (cc *clusterConn) do(exec func(c redis.Conn) (interface{}, error), commandName string, args []interface{}) (interface{}, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+
+	// 空命令用于flush 并接收pipeline 中全部结果
+	if commandName == "" {
+		if cc.conn == nil {
+			return nil, nil
+		}
+		cc.pending = 0
+		return exec(cc.conn)
+	}
+
+	// pipeline 中仍有未接收的回复时，必须在当前节点上执行
+	if cc.pending == 0 {
+		if err := cc.route(commandName, args); err != nil {
+			return nil, err
+		}
+	}
+	cc.pending = 0
+
+	maxRedirects := cc.cluster.cfg.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	reply, err := exec(cc.conn)
+	for i := 0; i < maxRedirects; i++ {
+		redirect, addr, ok := parseRedirect(err)
+		if !ok {
+			break
+		}
+
+		if redirect == "MOVED" {
+			// 槽位已迁移，刷新拓扑并转向新节点
+			cc.cluster.asyncRefresh()
+			if err := cc.bind(addr); err != nil {
+				return nil, err
+			}
+			reply, err = exec(cc.conn)
+			continue
+		}
+
+		// ASK：槽位迁移中，仅本次请求转向目标节点
+		conn, cerr := cc.cluster.getConnByAddrContext(cc.ctx, addr)
+		if cerr != nil {
+			return nil, cerr
+		}
+		if err := conn.Send("ASKING"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// ASKING 与命令一并发送，Do 返回最后一个命令的结果
+		reply, err = exec(conn)
+		conn.Close()
+	}
+
+	return reply, err
+}
+
+// Send 写入命令到输出缓冲
+func (cc *clusterConn) Send(commandName string, args ...interface{}) error {
+	if cc.err != nil {
+		return cc.err
+	}
+	if cc.pending == 0 {
+		if err := cc.route(commandName, args); err != nil {
+			return err
+		}
+	}
+	if err := cc.conn.Send(commandName, args...); err != nil {
+		return err
+	}
+	cc.pending++
+	return nil
+}
+
+// Flush 将输出缓冲发送到节点
+func (cc *clusterConn) Flush() error {
+	if cc.err != nil {
+		return cc.err
+	}
+	if cc.conn == nil {
+		return nil
+	}
+	return cc.conn.Flush()
+}
+
+// Receive 接收节点回复
+func (cc *clusterConn) Receive() (interface{}, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	if cc.conn == nil {
+		return nil, errors.New("[redis]cluster conn is not bound to any node")
+	}
+	if cc.pending > 0 {
+		cc.pending--
+	}
+	return cc.conn.Receive()
+}
+
+// ReceiveContext 实现redis.ConnWithContext
+func (cc *clusterConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	if cc.conn == nil {
+		return nil, errors.New("[redis]cluster conn is not bound to any node")
+	}
+	if cc.pending > 0 {
+		cc.pending--
+	}
+	return redis.ReceiveContext(cc.conn, ctx)
+}
+
+// ReceiveWithTimeout 实现redis.ConnWithTimeout
+func (cc *clusterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	if cc.conn == nil {
+		return nil, errors.New("[redis]cluster conn is not bound to any node")
+	}
+	if cc.pending > 0 {
+		cc.pending--
+	}
+	return redis.ReceiveWithTimeout(cc.conn, timeout)
+}
+
+// Err 返回连接错误
+func (cc *clusterConn) Err() error {
+	if cc.err != nil {
+		return cc.err
+	}
+	if cc.conn != nil {
+		return cc.conn.Err()
+	}
+	return nil
+}
+
+// Close 归还节点连接
+func (cc *clusterConn) Close() error {
+	if cc.err != nil {
+		return nil
+	}
+	cc.err = errors.New("[redis]cluster conn is closed")
+
+	if cc.conn != nil {
+		err := cc.conn.Close()
+		cc.conn = nil
+		return err
+	}
+	return nil
+}
+
+// parseRedirect 解析MOVED/ASK 错误
+/**
+格式：MOVED 3999 127.0.0.1:6381 或 ASK 3999 127.0.0.1:6381
+*/
+func parseRedirect(err error) (string, string, bool) {
+	re, ok := err.(redis.Error)
+	if !ok {
+		return "", "", false
+	}
+
+	parts := strings.Fields(string(re))
+	if len(parts) != 3 || (parts[0] != "MOVED" && parts[0] != "ASK") {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
+
+// commandKey 获取命令的第一个key
+func commandKey(commandName string, args []interface{}) (string, bool) {
+	pos := 0
+	switch strings.ToUpper(commandName) {
+	case "PING", "INFO", "CLUSTER", "SCRIPT", "ASKING", "READONLY", "READWRITE", "AUTH", "SELECT",
+		"MULTI", "EXEC", "DISCARD", "UNWATCH", "ROLE", "CONFIG", "DBSIZE", "TIME", "ECHO":
+		return "", false
+	case "XREAD", "XREADGROUP":
+		// XREADGROUP GROUP group consumer [COUNT n] [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...]
+		pos = -1
+		for i := range args {
+			if strings.ToUpper(keyString(args[i])) == "STREAMS" {
+				pos = i + 1
+				break
+			}
+		}
+		if pos < 0 {
+			return "", false
+		}
+	case "XGROUP", "XINFO":
+		// XGROUP CREATE key group id / XINFO STREAM key
+		pos = 1
+	case "EVAL", "EVALSHA":
+		// EVAL script numkeys key [key ...]
+		if len(args) < 3 {
+			return "", false
+		}
+		if n, err := strconv.Atoi(keyString(args[1])); err != nil || n == 0 {
+			return "", false
+		}
+		pos = 2
+	}
+
+	if len(args) <= pos {
+		return "", false
+	}
+	return keyString(args[pos]), true
+}
+
+// keyString 将key 参数转为字符串
+func keyString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// keySlot 计算key 所在槽位，支持hash tag（"{...}"）
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// splitBySlot 将keys 按照槽位分组，返回分组后的keys 以及其在原切片中的下标
+func splitBySlot(keys []string) ([][]string, [][]int) {
+	groupIndex := make(map[int]int)
+	groups := make([][]string, 0)
+	indexes := make([][]int, 0)
+
+	for i, key := range keys {
+		slot := keySlot(key)
+		g, ok := groupIndex[slot]
+		if !ok {
+			g = len(groups)
+			groupIndex[slot] = g
+			groups = append(groups, nil)
+			indexes = append(indexes, nil)
+		}
+		groups[g] = append(groups[g], key)
+		indexes[g] = append(indexes[g], i)
+	}
+	return groups, indexes
+}
+
+// crc16 CRC16-CCITT（XMODEM），Redis Cluster 槽位计算使用
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestKeySlot(t *testing.T) {
+	cases := map[string]int{
+		"123456789": 12739,
+		"foo":       12182,
+		"bar":       5061,
+	}
+	for key, slot := range cases {
+		if s := keySlot(key); s != slot {
+			t.Errorf("Key slot of '%s' is %d, want %d.", key, s, slot)
+			return
+		}
+	}
+
+	// hash tag
+	if keySlot("{user1000}.following") != keySlot("{user1000}.followers") {
+		t.Errorf("Hash tag keys should be in the same slot.")
+		return
+	}
+	if keySlot("foo{}{bar}") != int(crc16("foo{}{bar}")%clusterSlots) || keySlot("foo{}{bar}") == keySlot("bar") ||
+		keySlot("{}foo") == keySlot("foo") {
+		t.Errorf("Empty hash tag should use the whole key.")
+		return
+	}
+
+	groups, indexes := splitBySlot([]string{"{a}1", "b", "{a}2"})
+	if len(groups) != 2 || len(groups[0]) != 2 || indexes[0][1] != 2 {
+		t.Errorf("Split by slot err, groups: %v, indexes: %v.", groups, indexes)
+		return
+	}
+}
+
+func TestClusterSetSlots(t *testing.T) {
+	c := &cluster{cfg: &RedisConfig{Address: []string{"127.0.0.1:7000"}}, pools: make(map[string]*redis.Pool)}
+	for _, addr := range []string{"127.0.0.1:7000", "127.0.0.1:7001", "127.0.0.1:7002"} {
+		if _, err := c.getPool(addr); err != nil {
+			t.Errorf("Get pool err: %v.", err)
+			return
+		}
+	}
+	stale := c.pools["127.0.0.1:7002"]
+
+	// 7002 已不在槽位映射中，连接池被关闭；启动节点7000 保留
+	var slots [clusterSlots][]string
+	slots[0] = []string{"127.0.0.1:7001"}
+	c.setSlots(slots)
+	if len(c.pools) != 2 || c.pools["127.0.0.1:7000"] == nil || c.pools["127.0.0.1:7001"] == nil {
+		t.Errorf("Cluster pools after set slots: %v.", c.pools)
+		return
+	}
+	if err := stale.Get().Err(); err == nil || !strings.Contains(err.Error(), "closed pool") {
+		t.Errorf("Stale pool should be closed, err: %v.", err)
+		return
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	redirect, addr, ok := parseRedirect(redis.Error("MOVED 3999 127.0.0.1:6381"))
+	if !ok || redirect != "MOVED" || addr != "127.0.0.1:6381" {
+		t.Errorf("Parse MOVED err, redirect: %s, addr: %s.", redirect, addr)
+		return
+	}
+
+	redirect, addr, ok = parseRedirect(redis.Error("ASK 3999 127.0.0.1:6382"))
+	if !ok || redirect != "ASK" || addr != "127.0.0.1:6382" {
+		t.Errorf("Parse ASK err, redirect: %s, addr: %s.", redirect, addr)
+		return
+	}
+
+	if _, _, ok = parseRedirect(redis.Error("ERR unknown command")); ok {
+		t.Errorf("Parse redirect should fail.")
+		return
+	}
+}
+
+func TestCommandKey(t *testing.T) {
+	if key, ok := commandKey("GET", []interface{}{"k"}); !ok || key != "k" {
+		t.Errorf("Command key of GET err: %s.", key)
+		return
+	}
+	if key, ok := commandKey("EVALSHA", []interface{}{"sha", 1, "k"}); !ok || key != "k" {
+		t.Errorf("Command key of EVALSHA err: %s.", key)
+		return
+	}
+	if _, ok := commandKey("PING", nil); ok {
+		t.Errorf("PING should not have key.")
+		return
+	}
+}
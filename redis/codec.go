@@ -0,0 +1,317 @@
+package redis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/gomodule/redigo/redis"
+	"github.com/vmihailenco/msgpack/v4"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	CodecJSON     = "json"     // encoding/json
+	CodecMsgpack  = "msgpack"  // msgpack v4，默认
+	CodecProtobuf = "protobuf" // protobuf，value 需要实现proto.Message
+
+	CompressionNone   = ""       // 不压缩，默认
+	CompressionGzip   = "gzip"   // gzip
+	CompressionSnappy = "snappy" // snappy framing format
+
+	defaultCompressThreshold = 1024
+)
+
+// Codec 对象序列化
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Compressor 压缩算法
+/**
+Match 根据数据头部判断数据是否为该算法压缩，读取时据此决定是否解压，
+因此未达到压缩阈值的数据仍为codec 原始格式，可以与非Go 服务共享。
+*/
+type Compressor interface {
+	Name() string
+	Match(data []byte) bool
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecsMu    sync.RWMutex
+	codecs      = map[string]Codec{}
+	compressors = map[string]Compressor{}
+)
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(MsgpackCodec{})
+	RegisterCodec(ProtobufCodec{})
+	RegisterCompressor(GzipCompressor{})
+	RegisterCompressor(SnappyCompressor{})
+}
+
+// RegisterCodec 注册codec，RedisConfig.Codec 配置为codec.Name() 时使用
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// RegisterCompressor 注册压缩算法，RedisConfig.Compression 配置为compressor.Name() 时使用
+func RegisterCompressor(compressor Compressor) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	compressors[compressor.Name()] = compressor
+}
+
+// GetCodec 根据名称获取codec，名称为空时返回msgpack
+func GetCodec(name string) (Codec, error) {
+	if name == "" {
+		name = CodecMsgpack
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("[redis]unknown codec '%s'", name)
+	}
+	return codec, nil
+}
+
+// GetCompressor 根据名称获取压缩算法，名称为空时返回nil（不压缩）
+func GetCompressor(name string) (Compressor, error) {
+	if name == CompressionNone {
+		return nil, nil
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	compressor, ok := compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("[redis]unknown compression '%s'", name)
+	}
+	return compressor, nil
+}
+
+// JSONCodec encoding/json
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string                               { return CodecJSON }
+func (JSONCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// MsgpackCodec msgpack v4，与SetExpWithMP/GetWithMP 格式一致
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Name() string                               { return CodecMsgpack }
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// ProtobufCodec protobuf
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Name() string { return CodecProtobuf }
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("[redis]protobuf codec: %T is not proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("[redis]protobuf codec: %T is not proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// GzipCompressor gzip
+type GzipCompressor struct{}
+
+func (GzipCompressor) Name() string { return CompressionGzip }
+
+func (GzipCompressor) Match(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// snappyMagic snappy framing format 的stream identifier
+var snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+
+// SnappyCompressor snappy（framing format，带有stream identifier 便于识别）
+type SnappyCompressor struct{}
+
+func (SnappyCompressor) Name() string { return CompressionSnappy }
+
+func (SnappyCompressor) Match(data []byte) bool {
+	return bytes.HasPrefix(data, snappyMagic)
+}
+
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (SnappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return ioutil.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+}
+
+// objectCodec 根据配置组合codec 与压缩算法
+type objectCodec struct {
+	codec      Codec
+	compressor Compressor
+	threshold  int
+}
+
+// newObjectCodec 根据RedisConfig 新建objectCodec
+func newObjectCodec(cfg *RedisConfig) (*objectCodec, error) {
+	codec, err := GetCodec(cfg.Codec)
+	if err != nil {
+		return nil, err
+	}
+	compressor, err := GetCompressor(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := cfg.CompressThreshold
+	if threshold <= 0 {
+		threshold = defaultCompressThreshold
+	}
+	return &objectCodec{codec: codec, compressor: compressor, threshold: threshold}, nil
+}
+
+// encode 序列化，超过阈值时压缩
+func (c *objectCodec) encode(value interface{}) ([]byte, error) {
+	b, err := c.codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if c.compressor == nil || len(b) < c.threshold {
+		return b, nil
+	}
+	return c.compressor.Compress(b)
+}
+
+// decode 按需解压后反序列化
+func (c *objectCodec) decode(data []byte, value interface{}) error {
+	if c.compressor != nil && c.compressor.Match(data) {
+		b, err := c.compressor.Decompress(data)
+		if err != nil {
+			return err
+		}
+		data = b
+	}
+	return c.codec.Unmarshal(data, value)
+}
+
+// SetObject 使用配置的codec 序列化后存储value
+/**
+options 与SET 一致，例如SetWithPX 设置过期时间。
+*/
+func (r *Redis) SetObject(ctx context.Context, key string, value interface{}, options ...SetOption) error {
+	if value == nil {
+		return errors.New("[redis]value is nil")
+	}
+
+	b, err := r.codec.encode(value)
+	if err != nil {
+		return err
+	}
+	_, err = r.ExecCommandCtx(ctx, "SET", buildSetArgs(key, b, options)...)
+	return err
+}
+
+// GetObject 根据key 获取数据并使用配置的codec 反序列化到value（指针）
+/**
+key 不存在时返回redis.ErrNil。
+*/
+func (r *Redis) GetObject(ctx context.Context, key string, value interface{}) error {
+	b, err := redis.Bytes(r.ExecCommandCtx(ctx, "GET", key))
+	if err != nil {
+		return err
+	}
+	return r.codec.decode(b, value)
+}
+
+// MGetObjects 批量获取数据并反序列化到values（与keys 一一对应的指针）
+/**
+返回值与keys 一一对应，表示key 是否存在；key 不存在时对应的value 保持不变。
+*/
+func (r *Redis) MGetObjects(ctx context.Context, keys []string, values []interface{}) ([]bool, error) {
+	if len(keys) != len(values) {
+		return nil, errors.New("[redis]length of keys and values mismatch")
+	}
+	if len(keys) == 0 {
+		return []bool{}, nil
+	}
+
+	bs, err := r.MGETCtx(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(keys))
+	for i, b := range bs {
+		if b == nil {
+			continue
+		}
+		if err := r.codec.decode(b, values[i]); err != nil {
+			return nil, fmt.Errorf("[redis]decode key '%s' err: %v", keys[i], err)
+		}
+		found[i] = true
+	}
+	return found, nil
+}
+
+// Encode 使用配置的codec 序列化value（超过阈值时压缩），与SetObject 写入的数据格式一致
+func (r *Redis) Encode(value interface{}) ([]byte, error) {
+	return r.codec.encode(value)
+}
+
+// Decode 使用配置的codec 反序列化data（按需解压）到value（指针）
+func (r *Redis) Decode(data []byte, value interface{}) error {
+	return r.codec.decode(data, value)
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"bytes"
+	"testing"
+)
+
+type codecTestStruct struct {
+	Name  string `json:"name" msgpack:"name"`
+	Value []byte `json:"value" msgpack:"value"`
+}
+
+func TestObjectCodec(t *testing.T) {
+	for _, cfg := range []*RedisConfig{
+		{Codec: CodecJSON},
+		{Codec: CodecMsgpack, Compression: CompressionGzip, CompressThreshold: 64},
+		{Codec: CodecJSON, Compression: CompressionSnappy, CompressThreshold: 64},
+	} {
+		c, err := newObjectCodec(cfg)
+		if err != nil {
+			t.Errorf("New object codec err: %v.", err)
+			return
+		}
+
+		// 小于阈值时不压缩，大于阈值时压缩
+		for _, size := range []int{1, 4096} {
+			in := &codecTestStruct{Name: "test", Value: bytes.Repeat([]byte("a"), size)}
+			b, err := c.encode(in)
+			if err != nil {
+				t.Errorf("Encode err: %v.", err)
+				return
+			}
+			compressed := c.compressor != nil && c.compressor.Match(b)
+			if compressed != (c.compressor != nil && size > cfg.CompressThreshold) {
+				t.Errorf("Codec '%s' compression '%s' size %d compressed: %v.", cfg.Codec, cfg.Compression, size, compressed)
+				return
+			}
+
+			out := &codecTestStruct{}
+			if err := c.decode(b, out); err != nil {
+				t.Errorf("Decode err: %v.", err)
+				return
+			}
+			if out.Name != in.Name || !bytes.Equal(out.Value, in.Value) {
+				t.Errorf("Decode unexpected value: %+v.", out)
+				return
+			}
+		}
+	}
+
+	if _, err := newObjectCodec(&RedisConfig{Codec: "unknown"}); err == nil {
+		t.Errorf("Unknown codec should return err.")
+		return
+	}
+}
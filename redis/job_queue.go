@@ -0,0 +1,476 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// enqueueJobScript 保存任务数据并加入就绪队列
+/**
+KEYS[1]：就绪队列，KEYS[2]：任务数据hash，KEYS[3]：重试次数hash，KEYS[4]：处理中队列，KEYS[5]：死信队列
+ARGV[1]：任务id，ARGV[2]：任务数据，ARGV[3]：执行时间（毫秒）
+任务处理中时返回0，不覆盖；死信队列中的任务会被移出
+*/
+var enqueueJobScript = redis.NewScript(5, `
+	if redis.call("ZSCORE", KEYS[4], ARGV[1]) then
+		return 0
+	end
+	redis.call("ZREM", KEYS[5], ARGV[1])
+	redis.call("HSET", KEYS[2], ARGV[1], ARGV[2])
+	redis.call("HDEL", KEYS[3], ARGV[1])
+	redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+	return 1
+`)
+
+// claimJobScript 原子领取到期任务
+/**
+KEYS[1]：就绪队列，KEYS[2]：处理中队列，KEYS[3]：任务数据hash，KEYS[4]：重试次数hash，KEYS[5]：死信队列
+ARGV[1]：当前时间（毫秒），ARGV[2]：可见性超时时间点（毫秒），ARGV[3]：领取数量，ARGV[4]：最大执行次数
+1. 处理中队列里可见性超时的任务重新放回就绪队列，执行次数达到上限的放入死信队列；
+2. 领取就绪队列中score（执行时间）<= 当前时间的任务，移入处理中队列，并增加执行次数。
+返回：[id1, data1, attempts1, id2, data2, attempts2, ...]
+*/
+var claimJobScript = redis.NewScript(5, `
+	local expired = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", ARGV[1])
+	for _, id in ipairs(expired) do
+		redis.call("ZREM", KEYS[2], id)
+		local attempts = tonumber(redis.call("HGET", KEYS[4], id) or "0")
+		if attempts >= tonumber(ARGV[4]) then
+			redis.call("ZADD", KEYS[5], ARGV[1], id)
+		else
+			redis.call("ZADD", KEYS[1], ARGV[1], id)
+		end
+	end
+
+	local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+	local res = {}
+	for _, id in ipairs(ids) do
+		redis.call("ZREM", KEYS[1], id)
+		local data = redis.call("HGET", KEYS[3], id)
+		if data then
+			redis.call("ZADD", KEYS[2], ARGV[2], id)
+			local attempts = redis.call("HINCRBY", KEYS[4], id, 1)
+			table.insert(res, id)
+			table.insert(res, data)
+			table.insert(res, attempts)
+		end
+	end
+	return res
+`)
+
+// ackJobScript 任务执行成功，删除任务
+/**
+KEYS[1]：就绪队列，KEYS[2]：处理中队列，KEYS[3]：任务数据hash，KEYS[4]：重试次数hash
+ARGV[1]：任务id，ARGV[2]：领取时的执行次数
+执行次数不一致（任务超时后已被重新领取）或者任务已不在处理中队列时返回0，不删除任务
+*/
+var ackJobScript = redis.NewScript(4, `
+	if redis.call("HGET", KEYS[4], ARGV[1]) ~= ARGV[2] then
+		return 0
+	end
+	if redis.call("ZREM", KEYS[2], ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("ZREM", KEYS[1], ARGV[1])
+	redis.call("HDEL", KEYS[3], ARGV[1])
+	redis.call("HDEL", KEYS[4], ARGV[1])
+	return 1
+`)
+
+// failJobScript 任务执行失败，未达到最大执行次数时延迟重试，否则放入死信队列
+/**
+KEYS[1]：就绪队列，KEYS[2]：处理中队列，KEYS[3]：重试次数hash，KEYS[4]：死信队列
+ARGV[1]：任务id，ARGV[2]：当前时间（毫秒），ARGV[3]：重试时间（毫秒），ARGV[4]：最大执行次数，ARGV[5]：领取时的执行次数
+返回：1 重试，2 死信，0 任务已不在处理中队列或已被重新领取
+*/
+var failJobScript = redis.NewScript(4, `
+	local current = redis.call("HGET", KEYS[3], ARGV[1])
+	if current ~= ARGV[5] then
+		return 0
+	end
+	if redis.call("ZREM", KEYS[2], ARGV[1]) == 0 then
+		return 0
+	end
+	local attempts = tonumber(current)
+	if attempts >= tonumber(ARGV[4]) then
+		redis.call("ZADD", KEYS[4], ARGV[2], ARGV[1])
+		return 2
+	end
+	redis.call("ZADD", KEYS[1], ARGV[3], ARGV[1])
+	return 1
+`)
+
+// retryDeadJobScript 将死信任务重新放回就绪队列
+/**
+KEYS[1]：就绪队列，KEYS[2]：死信队列，KEYS[3]：重试次数hash
+ARGV[1]：任务id，ARGV[2]：执行时间（毫秒）
+*/
+var retryDeadJobScript = redis.NewScript(3, `
+	if redis.call("ZREM", KEYS[2], ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("HDEL", KEYS[3], ARGV[1])
+	return redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+`)
+
+var (
+	// ErrJobNotClaimed 任务已不在处理中队列，或者超时后已被其他worker 重新领取
+	ErrJobNotClaimed = errors.New("[redis]job is not claimed by this worker")
+	// ErrJobInFlight 任务正在处理中，不能覆盖
+	ErrJobInFlight = errors.New("[redis]job is being processed")
+)
+
+const (
+	defaultJobVisibilityTimeout = 30 * time.Second
+	defaultJobMaxAttempts       = 3
+	defaultJobRetryBackoff      = 5 * time.Second
+	defaultJobPollInterval      = time.Second
+)
+
+// Job 任务
+type Job struct {
+	ID       string
+	Payload  string
+	Attempts int // 当前为第几次执行，从1 开始
+}
+
+// JobQueueOption JobQueue 额外参数
+type JobQueueOption func(q *JobQueue)
+
+// JobQueueWithVisibilityTimeout 设置可见性超时，任务领取后超过该时间未ack 会重新放回就绪队列，默认30s
+func JobQueueWithVisibilityTimeout(timeout time.Duration) JobQueueOption {
+	return func(q *JobQueue) {
+		q.visibilityTimeout = timeout
+	}
+}
+
+// JobQueueWithMaxAttempts 设置最大执行次数，超过后放入死信队列，默认3
+func JobQueueWithMaxAttempts(maxAttempts int) JobQueueOption {
+	return func(q *JobQueue) {
+		q.maxAttempts = maxAttempts
+	}
+}
+
+// JobQueueWithRetryBackoff 设置失败重试的基础延迟，第n 次失败延迟n*backoff，默认5s
+func JobQueueWithRetryBackoff(backoff time.Duration) JobQueueOption {
+	return func(q *JobQueue) {
+		q.retryBackoff = backoff
+	}
+}
+
+// JobQueue 基于PriorityQueue 的可靠延迟/优先级任务队列
+/**
+就绪队列为PriorityQueue（score 为执行时间，毫秒），另外使用以下key：
+	QUEUE:{name}:processing	处理中队列（score 为可见性超时时间点）
+	QUEUE:{name}:data		任务数据
+	QUEUE:{name}:attempts	执行次数
+	QUEUE:{name}:dead		死信队列（score 为进入死信队列的时间）
+全部key 使用同一个hash tag，cluster 模式下位于同一槽位。
+*/
+type JobQueue struct {
+	pq *PriorityQueue // 就绪队列，不对外暴露，避免绕过任务数据及原子脚本直接修改
+
+	processingKey string
+	dataKey       string
+	attemptsKey   string
+	deadKey       string
+
+	visibilityTimeout time.Duration
+	maxAttempts       int
+	retryBackoff      time.Duration
+}
+
+// NewJobQueue 新建任务队列
+func NewJobQueue(queueName string, redisClient *Redis, options ...JobQueueOption) *JobQueue {
+	pq := NewPriorityQueue("{"+queueName+"}", redisClient)
+	q := &JobQueue{
+		pq:                pq,
+		processingKey:     pq.queueName + ":processing",
+		dataKey:           pq.queueName + ":data",
+		attemptsKey:       pq.queueName + ":attempts",
+		deadKey:           pq.queueName + ":dead",
+		visibilityTimeout: defaultJobVisibilityTimeout,
+		maxAttempts:       defaultJobMaxAttempts,
+		retryBackoff:      defaultJobRetryBackoff,
+	}
+	for _, f := range options {
+		f(q)
+	}
+	return q
+}
+
+// Enqueue 添加立即执行的任务，返回任务id
+func (q *JobQueue) Enqueue(ctx context.Context, payload string) (string, error) {
+	return q.EnqueueAt(ctx, payload, time.Now())
+}
+
+// EnqueueIn 添加延迟执行的任务，返回任务id
+func (q *JobQueue) EnqueueIn(ctx context.Context, payload string, delay time.Duration) (string, error) {
+	return q.EnqueueAt(ctx, payload, time.Now().Add(delay))
+}
+
+// EnqueueAt 添加在指定时间执行的任务，返回任务id
+func (q *JobQueue) EnqueueAt(ctx context.Context, payload string, runAt time.Time) (string, error) {
+	id := uuid.NewV4().String()
+	if err := q.EnqueueWithID(ctx, id, payload, runAt); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// EnqueueWithID 使用指定id 添加任务，id 已存在时覆盖任务数据及执行时间，并清零执行次数
+/**
+任务正在处理中（已领取未ack）时返回ErrJobInFlight，避免同一任务被重复执行；死信队列中的任务会被移出并重新入队。
+*/
+func (q *JobQueue) EnqueueWithID(ctx context.Context, id, payload string, runAt time.Time) error {
+	n, err := redis.Int(q.pq.cli.ExecScriptCtx(ctx, enqueueJobScript, q.pq.queueName, q.dataKey, q.attemptsKey, q.processingKey, q.deadKey,
+		id, payload, toMilliseconds(runAt)))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobInFlight
+	}
+	return nil
+}
+
+// Claim 原子领取最多limit 个到期任务，同时将可见性超时的任务重新入队
+func (q *JobQueue) Claim(ctx context.Context, limit int) ([]*Job, error) {
+	now := time.Now()
+	values, err := redis.Values(q.pq.cli.ExecScriptCtx(ctx, claimJobScript,
+		q.pq.queueName, q.processingKey, q.dataKey, q.attemptsKey, q.deadKey,
+		toMilliseconds(now), toMilliseconds(now.Add(q.visibilityTimeout)), limit, q.maxAttempts))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(values)/3)
+	for i := 0; i+2 < len(values); i += 3 {
+		id, err := redis.String(values[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := redis.String(values[i+1], nil)
+		if err != nil {
+			return nil, err
+		}
+		attempts, err := redis.Int(values[i+2], nil)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &Job{ID: id, Payload: payload, Attempts: attempts})
+	}
+	return jobs, nil
+}
+
+// Ack 任务执行成功，删除任务
+/**
+任务已超过可见性超时被重新领取（或已不在处理中队列）时返回ErrJobNotClaimed，不会删除任务。
+*/
+func (q *JobQueue) Ack(ctx context.Context, job *Job) error {
+	n, err := redis.Int(q.pq.cli.ExecScriptCtx(ctx, ackJobScript, q.pq.queueName, q.processingKey, q.dataKey, q.attemptsKey,
+		job.ID, job.Attempts))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotClaimed
+	}
+	return nil
+}
+
+// Fail 任务执行失败，未达到最大执行次数时延迟重试，否则放入死信队列
+/**
+返回任务是否进入死信队列。
+*/
+func (q *JobQueue) Fail(ctx context.Context, job *Job) (bool, error) {
+	now := time.Now()
+	retryAt := now.Add(time.Duration(job.Attempts) * q.retryBackoff)
+	n, err := redis.Int(q.pq.cli.ExecScriptCtx(ctx, failJobScript, q.pq.queueName, q.processingKey, q.attemptsKey, q.deadKey,
+		job.ID, toMilliseconds(now), toMilliseconds(retryAt), q.maxAttempts, job.Attempts))
+	if err != nil {
+		return false, err
+	}
+	return n == 2, nil
+}
+
+// DeadJobs 获取死信队列中最早的limit 个任务id
+func (q *JobQueue) DeadJobs(ctx context.Context, limit int) ([]string, error) {
+	return redis.Strings(q.pq.cli.ExecCommandCtx(ctx, "ZRANGE", q.deadKey, 0, limit-1))
+}
+
+// RetryDead 将死信任务重新放回就绪队列，执行次数清零
+func (q *JobQueue) RetryDead(ctx context.Context, id string) (bool, error) {
+	n, err := redis.Int(q.pq.cli.ExecScriptCtx(ctx, retryDeadJobScript, q.pq.queueName, q.deadKey, q.attemptsKey,
+		id, toMilliseconds(time.Now())))
+	return n == 1, err
+}
+
+// Payload 获取任务数据
+func (q *JobQueue) Payload(ctx context.Context, id string) (string, error) {
+	return redis.String(q.pq.cli.ExecCommandCtx(ctx, "HGET", q.dataKey, id))
+}
+
+// Stats 获取就绪、处理中、死信任务数量
+func (q *JobQueue) Stats(ctx context.Context) (ready, processing, dead int, err error) {
+	pipe := q.pq.cli.NewPipeline()
+	r := pipe.Send("ZCARD", q.pq.queueName)
+	p := pipe.Send("ZCARD", q.processingKey)
+	d := pipe.Send("ZCARD", q.deadKey)
+	if _, err = pipe.Exec(ctx); err != nil {
+		return
+	}
+	if ready, err = r.Int(); err != nil {
+		return
+	}
+	if processing, err = p.Int(); err != nil {
+		return
+	}
+	dead, err = d.Int()
+	return
+}
+
+// Clear 删除队列全部数据
+func (q *JobQueue) Clear() error {
+	_, err := q.pq.cli.DEL(q.pq.queueName, q.processingKey, q.dataKey, q.attemptsKey, q.deadKey)
+	return err
+}
+
+// toMilliseconds 时间转为毫秒时间戳
+func toMilliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// JobHandler 任务处理函数，返回error 时任务会被重试或者放入死信队列
+type JobHandler func(ctx context.Context, job *Job) error
+
+// Worker 任务消费者
+type Worker struct {
+	queue        *JobQueue
+	handler      JobHandler
+	concurrency  int
+	pollInterval time.Duration
+}
+
+// NewWorker 新建任务消费者，concurrency 为并发处理数量
+func (q *JobQueue) NewWorker(handler JobHandler, concurrency int) *Worker {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Worker{
+		queue:        q,
+		handler:      handler,
+		concurrency:  concurrency,
+		pollInterval: defaultJobPollInterval,
+	}
+}
+
+// SetPollInterval 设置没有到期任务时的轮询间隔，默认1s
+func (w *Worker) SetPollInterval(interval time.Duration) *Worker {
+	w.pollInterval = interval
+	return w
+}
+
+// Run 阻塞消费任务，ctx 取消后停止领取，并等待处理中的任务结束
+/**
+handler 的ctx 超时时间为可见性超时，超时后任务可能被其他消费者重新领取。
+*/
+func (w *Worker) Run(ctx context.Context) error {
+	if w.handler == nil {
+		return errors.New("[redis]job handler is nil")
+	}
+
+	tokens := make(chan struct{}, w.concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// 等待空闲的并发槽位
+		select {
+		case <-ctx.Done():
+			return nil
+		case tokens <- struct{}{}:
+		}
+		free := 1
+	fill:
+		for free < w.concurrency {
+			select {
+			case tokens <- struct{}{}:
+				free++
+			default:
+				break fill
+			}
+		}
+
+		jobs, err := w.queue.Claim(ctx, free)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("[redis]job queue '%s' claim err: %v.", w.queue.pq.queueName, err)
+		}
+
+		// 归还未使用的槽位
+		for i := len(jobs); i < free; i++ {
+			<-tokens
+		}
+
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job *Job) {
+				defer wg.Done()
+				defer func() { <-tokens }()
+				w.process(job)
+			}(job)
+		}
+
+		if len(jobs) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(w.pollInterval):
+			}
+		}
+	}
+}
+
+// process 处理单个任务
+func (w *Worker) process(job *Job) {
+	q := w.queue
+	ctx, cancel := context.WithTimeout(context.Background(), q.visibilityTimeout)
+	defer cancel()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("[redis]job handler panic: %v", r)
+			}
+		}()
+		return w.handler(ctx, job)
+	}()
+
+	if err == nil {
+		if err := q.Ack(context.Background(), job); err != nil {
+			logrus.Errorf("[redis]job queue '%s' ack job '%s' err: %v.", q.pq.queueName, job.ID, err)
+		}
+		return
+	}
+
+	dead, ferr := q.Fail(context.Background(), job)
+	if ferr != nil {
+		logrus.Errorf("[redis]job queue '%s' fail job '%s' err: %v.", q.pq.queueName, job.ID, ferr)
+		return
+	}
+	if dead {
+		logrus.Warnf("[redis]job queue '%s' job '%s' moved to dead letter after %d attempts, err: %v.",
+			q.pq.queueName, job.ID, job.Attempts, err)
+	}
+}
@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJobQueue(t *testing.T) {
+
+	// 获取Redis
+	var cfg = &RedisConfig{
+		Password:       "yZY0G0Dzh5N",
+		Address:        []string{"10.171.5.193:6382"},
+		DatabaseId:     0,
+		MaxIdle:        4,
+		MaxActive:      64,
+		IdleTimeout:    time.Duration(5000) * time.Millisecond,
+		ConnectTimeout: time.Duration(5000) * time.Millisecond,
+		ReadTimeout:    time.Duration(5000) * time.Millisecond,
+		WriteTimeout:   time.Duration(180) * time.Second,
+	}
+
+	redisClient, err := NewRedis(cfg)
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	// 获取JobQueue
+	queue := NewJobQueue("test_job_queue", redisClient,
+		JobQueueWithMaxAttempts(2),
+		JobQueueWithRetryBackoff(100*time.Millisecond),
+		JobQueueWithVisibilityTimeout(time.Second))
+	defer queue.Clear()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 添加任务
+	if _, err := queue.Enqueue(ctx, "job_ok"); err != nil {
+		t.Errorf("Job queue enqueue err: %v.", err)
+		return
+	}
+	failID, err := queue.EnqueueIn(ctx, "job_fail", 200*time.Millisecond)
+	if err != nil {
+		t.Errorf("Job queue enqueue in err: %v.", err)
+		return
+	}
+
+	// 消费任务
+	var handled int32
+	worker := queue.NewWorker(func(ctx context.Context, job *Job) error {
+		atomic.AddInt32(&handled, 1)
+		if job.Payload == "job_fail" {
+			return errors.New("job failed")
+		}
+		return nil
+	}, 4).SetPollInterval(50 * time.Millisecond)
+
+	runCtx, stop := context.WithTimeout(ctx, 2*time.Second)
+	defer stop()
+	_ = worker.Run(runCtx)
+
+	// job_ok 执行1 次，job_fail 执行2 次后进入死信队列
+	if n := atomic.LoadInt32(&handled); n != 3 {
+		t.Errorf("Job handled %d times, want 3.", n)
+		return
+	}
+
+	dead, err := queue.DeadJobs(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0] != failID {
+		t.Errorf("Job queue dead jobs err: %v, dead: %v.", err, dead)
+		return
+	}
+
+	// 处理中的任务不能被覆盖
+	if err := queue.EnqueueWithID(ctx, "job_inflight", "job_inflight", time.Now()); err != nil {
+		t.Errorf("Job queue enqueue with id err: %v.", err)
+		return
+	}
+	jobs, err := queue.Claim(ctx, 1)
+	if err != nil || len(jobs) != 1 {
+		t.Errorf("Job queue claim err: %v, jobs: %v.", err, jobs)
+		return
+	}
+	if err := queue.EnqueueWithID(ctx, "job_inflight", "job_new", time.Now()); err != ErrJobInFlight {
+		t.Errorf("Job queue enqueue in-flight job unexpected err: %v.", err)
+		return
+	}
+	if err := queue.Ack(ctx, jobs[0]); err != nil {
+		t.Errorf("Job queue ack err: %v.", err)
+		return
+	}
+
+	// 死信任务重新入队后移出死信队列
+	if err := queue.EnqueueWithID(ctx, failID, "job_fail", time.Now().Add(time.Hour)); err != nil {
+		t.Errorf("Job queue enqueue dead job err: %v.", err)
+		return
+	}
+	if dead, err := queue.DeadJobs(ctx, 10); err != nil || len(dead) != 0 {
+		t.Errorf("Job queue dead jobs after enqueue err: %v, dead: %v.", err, dead)
+		return
+	}
+
+	ready, processing, deadNum, err := queue.Stats(ctx)
+	if err != nil {
+		t.Errorf("Job queue stats err: %v.", err)
+		return
+	}
+	t.Log(ready, processing, deadNum)
+}
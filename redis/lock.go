@@ -18,6 +18,9 @@ var deleteAndRPUSHScript = redis.NewScript(2, `
 `)
 
 // TryGetLock 扩展NX 实现锁，该锁是非阻塞的
+/**
+[NOTE] 不支持续期及fencing token，推荐使用Mutex。
+*/
 func (r *Redis) TryGetLock(key, value string, expireTimeSeconds int64) (bool, error) {
 	ok, err := r.SET(key, value, SetWithEX(int(expireTimeSeconds)), SetWithNX())
 	if ok == "OK" && err == nil {
@@ -36,8 +39,11 @@ func (r *Redis) WaitForGetLock(waitKey string, expireTimeSeconds int64) (bool, e
 }
 
 // ReleaseLockAndRpush 释放锁并且重新添加
+/**
+cluster 模式下key 与waitKey 需要位于同一槽位（可使用hash tag，例如"{order}:lock"、"{order}:wait"）。
+*/
 func (r *Redis) ReleaseLockAndRpush(key, waitKey, value string) error {
-	rp := r.redisPool.Get()
+	rp := r.getConn()
 	defer rp.Close()
 	_, err := deleteAndRPUSHScript.Do(rp, key, waitKey, value)
 	return err
@@ -0,0 +1,380 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	uuid "github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrLockNotObtained 锁已被其他持有者占用
+	ErrLockNotObtained = errors.New("[redis]lock not obtained")
+	// ErrLockNotHeld 当前未持有锁（未加锁、已释放或已过期）
+	ErrLockNotHeld = errors.New("[redis]lock not held")
+)
+
+// lockScript 加锁并自增fencing 计数器
+/**
+KEYS[1]：锁key，KEYS[2]：fencing key
+ARGV[1]：owner token，ARGV[2]：过期时间（毫秒）
+成功返回fencing token，失败返回0
+*/
+var lockScript = redis.NewScript(2, `
+	if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+		return redis.call("INCR", KEYS[2])
+	end
+	return 0
+`)
+
+// unlockScript 比较owner token 后删除锁
+var unlockScript = redis.NewScript(1, `
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	end
+	return 0
+`)
+
+// extendScript 比较owner token 后续期锁
+var extendScript = redis.NewScript(1, `
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	end
+	return 0
+`)
+
+const (
+	defaultMutexTTL         = 8 * time.Second
+	defaultMutexRetryDelay  = 50 * time.Millisecond
+	defaultMutexRetryJitter = 50 * time.Millisecond
+
+	// redlockClockDriftFactor Redlock 时钟漂移系数
+	redlockClockDriftFactor = 0.01
+)
+
+// MutexOption Mutex 额外参数
+type MutexOption func(m *Mutex)
+
+// MutexWithTTL 设置锁的过期时间，默认8s，不能小于1ms
+func MutexWithTTL(ttl time.Duration) MutexOption {
+	return func(m *Mutex) {
+		m.ttl = ttl
+	}
+}
+
+// MutexWithRetry 设置Lock 重试间隔及随机抖动，默认50ms + [0, 50ms)
+func MutexWithRetry(delay, jitter time.Duration) MutexOption {
+	return func(m *Mutex) {
+		m.retryDelay = delay
+		m.retryJitter = jitter
+	}
+}
+
+// MutexWithWatchdog 设置是否开启看门狗自动续期，默认开启，续期间隔为ttl/3
+func MutexWithWatchdog(enable bool) MutexOption {
+	return func(m *Mutex) {
+		m.watchdog = enable
+	}
+}
+
+// Mutex 分布式锁
+/**
+1. 每次加锁生成随机owner token，释放/续期时比较token，不会误删其他持有者的锁；
+2. 加锁成功后看门狗按ttl/3 的间隔续期，续期失败（锁已丢失）时关闭Lost() 返回的channel；
+3. 每次加锁成功返回单调递增的fencing token，下游存储可据此拒绝过期持有者的写入；
+4. 传入多个相互独立的Redis 时使用Redlock 算法，需要在多数节点上加锁成功。
+同一个Mutex 不能被多个goroutine 同时加锁。
+*/
+type Mutex struct {
+	clients  []*Redis
+	key      string
+	fenceKey string
+
+	ttl         time.Duration
+	retryDelay  time.Duration
+	retryJitter time.Duration
+	watchdog    bool
+
+	mu     sync.Mutex
+	token  string
+	fence  int64
+	lost   chan struct{}
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewMutex 新建分布式锁
+/**
+cluster 模式下锁key 与fencing key 会位于同一槽位。
+*/
+func NewMutex(client *Redis, key string, options ...MutexOption) *Mutex {
+	return NewRedlock([]*Redis{client}, key, options...)
+}
+
+// NewRedlock 新建基于多个独立Redis 实例的Redlock 分布式锁
+func NewRedlock(clients []*Redis, key string, options ...MutexOption) *Mutex {
+	m := &Mutex{
+		clients:     clients,
+		key:         key,
+		fenceKey:    fenceKeyOf(key),
+		ttl:         defaultMutexTTL,
+		retryDelay:  defaultMutexRetryDelay,
+		retryJitter: defaultMutexRetryJitter,
+		watchdog:    true,
+	}
+	for _, f := range options {
+		f(m)
+	}
+	return m
+}
+
+// fenceKeyOf 获取fencing key，与锁key 位于同一槽位
+func fenceKeyOf(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key + ":fence"
+		}
+	}
+	return "{" + key + "}:fence"
+}
+
+// Key 获取锁key
+func (m *Mutex) Key() string {
+	return m.key
+}
+
+// Token 获取当前持有锁的owner token
+func (m *Mutex) Token() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token
+}
+
+// Fence 获取当前持有锁的fencing token
+func (m *Mutex) Fence() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fence
+}
+
+// Lost 锁丢失（看门狗续期失败）时关闭的channel，未持有锁时返回nil
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lost
+}
+
+// quorum 加锁成功需要的节点数量
+func (m *Mutex) quorum() int {
+	return len(m.clients)/2 + 1
+}
+
+// TryLock 尝试加锁，锁被占用时返回ErrLockNotObtained
+func (m *Mutex) TryLock(ctx context.Context) error {
+	if len(m.clients) == 0 {
+		return errors.New("[redis]mutex clients is empty")
+	}
+	if m.ttl < time.Millisecond {
+		return errors.New("[redis]mutex ttl must be at least 1ms")
+	}
+	if m.Token() != "" {
+		return errors.New("[redis]mutex is already locked by this instance")
+	}
+
+	token := uuid.NewV4().String()
+	start := time.Now()
+
+	var (
+		fence   int64
+		lastErr error
+	)
+	success, failed := 0, 0
+	for _, client := range m.clients {
+		f, err := redis.Int64(client.ExecScriptCtx(ctx, lockScript, m.key, m.fenceKey, token, m.ttl.Milliseconds()))
+		if err != nil {
+			lastErr = err
+			failed++
+			continue
+		}
+		if f == 0 {
+			continue
+		}
+		success++
+		if f > fence {
+			fence = f
+		}
+	}
+
+	// Redlock：多数节点加锁成功，且剩余有效时间大于0
+	drift := time.Duration(float64(m.ttl)*redlockClockDriftFactor) + 2*time.Millisecond
+	if success < m.quorum() || time.Since(start)+drift >= m.ttl {
+		m.release(token)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// 出错的节点足以导致未达到多数时返回错误，而不是当作锁被占用
+		if lastErr != nil && success+failed >= m.quorum() {
+			return lastErr
+		}
+		return ErrLockNotObtained
+	}
+
+	stopCh, lost := make(chan struct{}), make(chan struct{})
+	m.mu.Lock()
+	m.token = token
+	m.fence = fence
+	m.lost = lost
+	m.stopCh = stopCh
+	m.mu.Unlock()
+
+	if m.watchdog {
+		m.wg.Add(1)
+		go m.watch(token, stopCh, lost)
+	}
+	return nil
+}
+
+// Lock 阻塞加锁，锁被占用时按照重试间隔+随机抖动重试，直到成功、出错或者ctx 取消
+func (m *Mutex) Lock(ctx context.Context) error {
+	for {
+		err := m.TryLock(ctx)
+		if err != ErrLockNotObtained {
+			return err
+		}
+
+		delay := m.retryDelay
+		if m.retryJitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(m.retryJitter)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Extend 续期锁，重置为ttl
+func (m *Mutex) Extend(ctx context.Context) error {
+	token := m.Token()
+	if token == "" {
+		return ErrLockNotHeld
+	}
+	return m.extend(ctx, token)
+}
+
+// extend 在多数节点上续期
+func (m *Mutex) extend(ctx context.Context, token string) error {
+	success := 0
+	var lastErr error
+	for _, client := range m.clients {
+		n, err := redis.Int(client.ExecScriptCtx(ctx, extendScript, m.key, token, m.ttl.Milliseconds()))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if n == 1 {
+			success++
+		}
+	}
+
+	if success < m.quorum() {
+		if lastErr != nil {
+			return lastErr
+		}
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Unlock 释放锁（比较owner token 后删除），并停止看门狗
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	token := m.token
+	stopCh := m.stopCh
+	m.token = ""
+	m.stopCh = nil
+	m.mu.Unlock()
+
+	if token == "" {
+		return ErrLockNotHeld
+	}
+	if stopCh != nil {
+		close(stopCh)
+	}
+	m.wg.Wait()
+
+	success := 0
+	var lastErr error
+	for _, client := range m.clients {
+		n, err := redis.Int(client.ExecScriptCtx(ctx, unlockScript, m.key, token))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if n == 1 {
+			success++
+		}
+	}
+
+	if success < m.quorum() {
+		if lastErr != nil {
+			return lastErr
+		}
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// release 加锁失败时释放已经获取的节点
+func (m *Mutex) release(token string) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.ttl)
+	defer cancel()
+
+	for _, client := range m.clients {
+		_, _ = client.ExecScriptCtx(ctx, unlockScript, m.key, token)
+	}
+}
+
+// watch 看门狗，每ttl/3 续期一次
+func (m *Mutex) watch(token string, stopCh chan struct{}, lost chan struct{}) {
+	defer m.wg.Done()
+
+	interval := m.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastExtend := time.Now()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			err := m.extend(ctx, token)
+			cancel()
+			if err == nil {
+				lastExtend = time.Now()
+				continue
+			}
+
+			// 网络错误时下个周期重试，锁确定丢失或者已超过ttl 未续期成功时退出
+			if err != ErrLockNotHeld && time.Since(lastExtend) < m.ttl {
+				logrus.Errorf("[redis]mutex '%s' extend err: %v.", m.key, err)
+				continue
+			}
+			logrus.Warnf("[redis]mutex '%s' lost, err: %v.", m.key, err)
+			close(lost)
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMutex(t *testing.T) {
+
+	// 获取Redis
+	var cfg = &RedisConfig{
+		Password:       "yZY0G0Dzh5N",
+		Address:        []string{"10.171.5.193:6382"},
+		DatabaseId:     0,
+		MaxIdle:        4,
+		MaxActive:      64,
+		IdleTimeout:    time.Duration(5000) * time.Millisecond,
+		ConnectTimeout: time.Duration(5000) * time.Millisecond,
+		ReadTimeout:    time.Duration(5000) * time.Millisecond,
+		WriteTimeout:   time.Duration(180) * time.Second,
+	}
+
+	redisClient, err := NewRedis(cfg)
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 加锁
+	mutex := NewMutex(redisClient, "test_mutex", MutexWithTTL(3*time.Second))
+	if err := mutex.Lock(ctx); err != nil {
+		t.Errorf("Mutex lock err: %v.", err)
+		return
+	}
+	t.Log(mutex.Token(), mutex.Fence())
+
+	// 其他持有者无法获取
+	other := NewMutex(redisClient, "test_mutex")
+	if err := other.TryLock(ctx); err != ErrLockNotObtained {
+		t.Errorf("Mutex try lock should fail, err: %v.", err)
+		return
+	}
+
+	// 看门狗续期，超过ttl 后仍持有锁
+	time.Sleep(4 * time.Second)
+	select {
+	case <-mutex.Lost():
+		t.Errorf("Mutex lost.")
+		return
+	default:
+	}
+
+	if err := mutex.Unlock(ctx); err != nil {
+		t.Errorf("Mutex unlock err: %v.", err)
+		return
+	}
+
+	// fencing token 单调递增
+	if err := other.Lock(ctx); err != nil {
+		t.Errorf("Mutex lock err: %v.", err)
+		return
+	}
+	if other.Fence() <= mutex.Fence() {
+		t.Errorf("Mutex fence should increase, %d <= %d.", other.Fence(), mutex.Fence())
+		return
+	}
+	_ = other.Unlock(ctx)
+}
+
+func TestFenceKeyOf(t *testing.T) {
+	for _, key := range []string{"order_lock", "{order}:lock"} {
+		if keySlot(key) != keySlot(fenceKeyOf(key)) {
+			t.Errorf("Fence key of '%s' should be in the same slot.", key)
+			return
+		}
+	}
+}
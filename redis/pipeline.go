@@ -0,0 +1,392 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrTxConflict 事务执行期间WATCH 的key 被修改，且重试次数已用完
+var ErrTxConflict = errors.New("[redis]transaction conflict, watched keys changed")
+
+// PipelineReply pipeline/事务中单条命令的回复，在Exec 之后可用
+type PipelineReply struct {
+	Value interface{}
+	Err   error
+}
+
+// String 转为string
+func (pr *PipelineReply) String() (string, error) {
+	return redis.String(pr.Value, pr.Err)
+}
+
+// Int 转为int
+func (pr *PipelineReply) Int() (int, error) {
+	return redis.Int(pr.Value, pr.Err)
+}
+
+// Int64 转为int64
+func (pr *PipelineReply) Int64() (int64, error) {
+	return redis.Int64(pr.Value, pr.Err)
+}
+
+// Float64 转为float64
+func (pr *PipelineReply) Float64() (float64, error) {
+	return redis.Float64(pr.Value, pr.Err)
+}
+
+// Bool 转为bool
+func (pr *PipelineReply) Bool() (bool, error) {
+	return redis.Bool(pr.Value, pr.Err)
+}
+
+// Bytes 转为[]byte
+func (pr *PipelineReply) Bytes() ([]byte, error) {
+	return redis.Bytes(pr.Value, pr.Err)
+}
+
+// Strings 转为[]string
+func (pr *PipelineReply) Strings() ([]string, error) {
+	return redis.Strings(pr.Value, pr.Err)
+}
+
+// set 设置回复，redis.Error 作为该条命令的错误
+func (pr *PipelineReply) set(value interface{}, err error) {
+	if e, ok := value.(redis.Error); ok && err == nil {
+		pr.Value, pr.Err = nil, e
+		return
+	}
+	pr.Value, pr.Err = value, err
+}
+
+// pipelineCmd pipeline 中排队的命令
+type pipelineCmd struct {
+	name  string
+	args  []interface{}
+	reply *PipelineReply
+}
+
+// Pipeline 批量发送命令，一次往返后按顺序返回回复
+/**
+cluster 模式下按照key 所在节点拆分为多个pipeline，结果顺序与Send 顺序保持一致。
+Pipeline 不是并发安全的。
+*/
+type Pipeline struct {
+	cli  *Redis
+	cmds []*pipelineCmd
+}
+
+// NewPipeline 新建pipeline
+func (r *Redis) NewPipeline() *Pipeline {
+	return &Pipeline{cli: r}
+}
+
+// Len 获取排队的命令数量
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Send 排队命令，返回的PipelineReply 在Exec 之后可用
+func (p *Pipeline) Send(command string, args ...interface{}) *PipelineReply {
+	cmd := &pipelineCmd{name: command, args: args, reply: &PipelineReply{}}
+	p.cmds = append(p.cmds, cmd)
+	return cmd.reply
+}
+
+// SET 排队SET 命令，支持SetOption
+func (p *Pipeline) SET(key string, value interface{}, options ...SetOption) *PipelineReply {
+	return p.Send("SET", buildSetArgs(key, value, options)...)
+}
+
+// GET 排队GET 命令
+func (p *Pipeline) GET(key string) *PipelineReply {
+	return p.Send("GET", key)
+}
+
+// DEL 排队DEL 命令
+func (p *Pipeline) DEL(keys ...string) *PipelineReply {
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	return p.Send("DEL", args...)
+}
+
+// EXISTS 排队EXISTS 命令
+func (p *Pipeline) EXISTS(key string) *PipelineReply {
+	return p.Send("EXISTS", key)
+}
+
+// EXPIRE 排队EXPIRE 命令
+func (p *Pipeline) EXPIRE(key string, seconds int) *PipelineReply {
+	return p.Send("EXPIRE", key, seconds)
+}
+
+// PEXPIRE 排队PEXPIRE 命令
+func (p *Pipeline) PEXPIRE(key string, milliseconds int) *PipelineReply {
+	return p.Send("PEXPIRE", key, milliseconds)
+}
+
+// PEXPIREAT 排队PEXPIREAT 命令
+func (p *Pipeline) PEXPIREAT(key string, millisecondsTimestamp int64) *PipelineReply {
+	return p.Send("PEXPIREAT", key, millisecondsTimestamp)
+}
+
+// PTTL 排队PTTL 命令
+func (p *Pipeline) PTTL(key string) *PipelineReply {
+	return p.Send("PTTL", key)
+}
+
+// LPUSH 排队LPUSH 命令
+func (p *Pipeline) LPUSH(key, value string) *PipelineReply {
+	return p.Send("LPUSH", key, value)
+}
+
+// RPOP 排队RPOP 命令
+func (p *Pipeline) RPOP(key string) *PipelineReply {
+	return p.Send("RPOP", key)
+}
+
+// Exec 发送全部排队命令并按顺序返回回复，执行后清空队列
+/**
+返回的error 为网络等连接级错误；单条命令的错误记录在对应PipelineReply.Err 中。
+*/
+func (p *Pipeline) Exec(ctx context.Context) ([]*PipelineReply, error) {
+	cmds := p.cmds
+	p.cmds = nil
+
+	replies := make([]*PipelineReply, len(cmds))
+	for i := range cmds {
+		replies[i] = cmds[i].reply
+	}
+	if len(cmds) == 0 {
+		return replies, nil
+	}
+
+	if p.cli.cluster != nil {
+		return replies, p.execCluster(ctx, cmds)
+	}
+
+	rc, err := p.cli.getConnContext(ctx)
+	if err != nil {
+		return replies, err
+	}
+	defer rc.Close()
+
+	return replies, execPipeline(ctx, rc, cmds)
+}
+
+// execCluster 按照节点拆分pipeline，遇到MOVED/ASK 的命令单独重试
+func (p *Pipeline) execCluster(ctx context.Context, cmds []*pipelineCmd) error {
+	c := p.cli.cluster
+	groups := make(map[string][]*pipelineCmd)
+	for _, cmd := range cmds {
+		addr := c.addrBySlot(rand.Intn(clusterSlots))
+		if key, ok := commandKey(cmd.name, cmd.args); ok {
+			addr = c.addrBySlot(keySlot(key))
+		}
+		groups[addr] = append(groups[addr], cmd)
+	}
+
+	for addr, group := range groups {
+		conn, err := c.getConnByAddrContext(ctx, addr)
+		if err != nil {
+			return err
+		}
+		err = execPipeline(ctx, conn, group)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, cmd := range group {
+			if _, _, ok := parseRedirect(cmd.reply.Err); ok {
+				cmd.reply.set(p.cli.ExecCommandCtx(ctx, cmd.name, cmd.args...))
+			}
+		}
+	}
+	return nil
+}
+
+// execPipeline 在同一连接上发送命令并接收回复
+func execPipeline(ctx context.Context, rc redis.Conn, cmds []*pipelineCmd) error {
+	for _, cmd := range cmds {
+		if err := rc.Send(cmd.name, cmd.args...); err != nil {
+			return err
+		}
+	}
+
+	values, err := redis.Values(redis.DoContext(rc, ctx, ""))
+	if err != nil {
+		return err
+	}
+	if len(values) != len(cmds) {
+		return errors.New("[redis]pipeline reply count mismatch")
+	}
+	for i := range cmds {
+		cmds[i].reply.set(values[i], nil)
+	}
+	return nil
+}
+
+// Tx WATCH/MULTI/EXEC 事务
+/**
+Do 在WATCH 的连接上立即执行命令（用于读取当前值）；
+Send 及SET/GET 等方法排队的命令会在MULTI/EXEC 中执行，回复在事务提交后可用。
+*/
+type Tx struct {
+	p    *Pipeline
+	ctx  context.Context
+	conn redis.Conn
+}
+
+// Do 在事务连接上立即执行命令
+func (tx *Tx) Do(command string, args ...interface{}) (interface{}, error) {
+	return redis.DoContext(tx.conn, tx.ctx, command, args...)
+}
+
+// Len 获取排队的命令数量
+func (tx *Tx) Len() int {
+	return tx.p.Len()
+}
+
+// Send 排队命令，返回的PipelineReply 在事务提交后可用
+func (tx *Tx) Send(command string, args ...interface{}) *PipelineReply {
+	return tx.p.Send(command, args...)
+}
+
+// SET 排队SET 命令，支持SetOption
+func (tx *Tx) SET(key string, value interface{}, options ...SetOption) *PipelineReply {
+	return tx.p.SET(key, value, options...)
+}
+
+// GET 排队GET 命令
+func (tx *Tx) GET(key string) *PipelineReply {
+	return tx.p.GET(key)
+}
+
+// DEL 排队DEL 命令
+func (tx *Tx) DEL(keys ...string) *PipelineReply {
+	return tx.p.DEL(keys...)
+}
+
+// EXISTS 排队EXISTS 命令
+func (tx *Tx) EXISTS(key string) *PipelineReply {
+	return tx.p.EXISTS(key)
+}
+
+// EXPIRE 排队EXPIRE 命令
+func (tx *Tx) EXPIRE(key string, seconds int) *PipelineReply {
+	return tx.p.EXPIRE(key, seconds)
+}
+
+// PEXPIRE 排队PEXPIRE 命令
+func (tx *Tx) PEXPIRE(key string, milliseconds int) *PipelineReply {
+	return tx.p.PEXPIRE(key, milliseconds)
+}
+
+// PEXPIREAT 排队PEXPIREAT 命令
+func (tx *Tx) PEXPIREAT(key string, millisecondsTimestamp int64) *PipelineReply {
+	return tx.p.PEXPIREAT(key, millisecondsTimestamp)
+}
+
+// PTTL 排队PTTL 命令
+func (tx *Tx) PTTL(key string) *PipelineReply {
+	return tx.p.PTTL(key)
+}
+
+// LPUSH 排队LPUSH 命令
+func (tx *Tx) LPUSH(key, value string) *PipelineReply {
+	return tx.p.LPUSH(key, value)
+}
+
+// RPOP 排队RPOP 命令
+func (tx *Tx) RPOP(key string) *PipelineReply {
+	return tx.p.RPOP(key)
+}
+
+// Tx 乐观事务：WATCH keys，执行fn 排队命令，再通过MULTI/EXEC 提交
+/**
+EXEC 因WATCH 的key 被修改而失败时，最多重试maxRetries 次（每次重新执行fn），仍失败时返回ErrTxConflict；
+fn 返回error 时放弃事务并返回该error。
+cluster 模式下keys 以及事务中的全部key 需要位于同一槽位（可使用hash tag）。
+*/
+func (r *Redis) Tx(ctx context.Context, keys []string, maxRetries int, fn func(tx *Tx) error) error {
+	if len(keys) == 0 {
+		return errors.New("[redis]tx watch keys is empty")
+	}
+
+	for i := 0; i <= maxRetries; i++ {
+		if i > 0 {
+			// 冲突后随机退避，避免多个客户端同时重试
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(rand.Intn(10*i)+1) * time.Millisecond):
+			}
+		}
+
+		ok, err := r.tx(ctx, keys, fn)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return ErrTxConflict
+}
+
+// tx 执行一次事务，返回EXEC 是否成功
+func (r *Redis) tx(ctx context.Context, keys []string, fn func(tx *Tx) error) (bool, error) {
+	rc, err := r.getConnContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	watchArgs := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		watchArgs = append(watchArgs, key)
+	}
+	if _, err := redis.DoContext(rc, ctx, "WATCH", watchArgs...); err != nil {
+		return false, err
+	}
+
+	tx := &Tx{p: r.NewPipeline(), ctx: ctx, conn: rc}
+	if err := fn(tx); err != nil {
+		_, _ = redis.DoContext(rc, ctx, "UNWATCH")
+		return false, err
+	}
+
+	cmds := tx.p.cmds
+	tx.p.cmds = nil
+
+	if err := rc.Send("MULTI"); err != nil {
+		return false, err
+	}
+	for _, cmd := range cmds {
+		if err := rc.Send(cmd.name, cmd.args...); err != nil {
+			return false, err
+		}
+	}
+
+	values, err := redis.Values(redis.DoContext(rc, ctx, "EXEC"))
+	if err == redis.ErrNil {
+		// WATCH 的key 被修改
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(values) != len(cmds) {
+		return false, errors.New("[redis]tx reply count mismatch")
+	}
+	for i := range cmds {
+		cmds[i].reply.set(values[i], nil)
+	}
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	var mu sync.Mutex
+	data := make(map[string]string)
+
+	addr := fakeServer(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch args[0] {
+		case "AUTH", "SELECT":
+			return "+OK\r\n"
+		case "SET":
+			data[args[1]] = args[2]
+			return "+OK\r\n"
+		case "GET":
+			v, ok := data[args[1]]
+			if !ok {
+				return "$-1\r\n"
+			}
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	redisClient, err := NewRedis(&RedisConfig{Address: []string{addr}, MaxIdle: 4, MaxActive: 64})
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	pipe := redisClient.NewPipeline()
+	set := pipe.SET("field_pipe", "value_pipe", SetWithEX(5))
+	get := pipe.GET("field_pipe")
+	unknown := pipe.Send("UNKNOWN")
+
+	replies, err := pipe.Exec(context.Background())
+	if err != nil || len(replies) != 3 {
+		t.Errorf("Pipeline exec err: %v, replies: %d.", err, len(replies))
+		return
+	}
+
+	if v, err := set.String(); err != nil || v != "OK" {
+		t.Errorf("Pipeline set err: %v, reply: %s.", err, v)
+		return
+	}
+	if v, err := get.String(); err != nil || v != "value_pipe" {
+		t.Errorf("Pipeline get err: %v, reply: %s.", err, v)
+		return
+	}
+	if unknown.Err == nil {
+		t.Errorf("Pipeline unknown command should return err.")
+		return
+	}
+	if pipe.Len() != 0 {
+		t.Errorf("Pipeline should be empty after exec.")
+		return
+	}
+}
+
+func TestTx(t *testing.T) {
+	var mu sync.Mutex
+	conflicts := 1 // 第一次EXEC 模拟WATCH 冲突
+	queued := 0
+
+	addr := fakeServer(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch args[0] {
+		case "AUTH", "SELECT", "WATCH", "MULTI", "UNWATCH":
+			return "+OK\r\n"
+		case "GET":
+			return "$1\r\n1\r\n"
+		case "SET":
+			queued++
+			return "+QUEUED\r\n"
+		case "EXEC":
+			n := queued
+			queued = 0
+			if conflicts > 0 {
+				conflicts--
+				return "*-1\r\n"
+			}
+			reply := fmt.Sprintf("*%d\r\n", n)
+			for i := 0; i < n; i++ {
+				reply += "+OK\r\n"
+			}
+			return reply
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	redisClient, err := NewRedis(&RedisConfig{Address: []string{addr}, MaxIdle: 4, MaxActive: 64})
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	runs := 0
+	var set *PipelineReply
+	err = redisClient.Tx(context.Background(), []string{"field_tx"}, 3, func(tx *Tx) error {
+		runs++
+		v, err := tx.Do("GET", "field_tx")
+		if err != nil {
+			return err
+		}
+		set = tx.SET("field_tx", string(v.([]byte))+"1")
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Tx err: %v.", err)
+		return
+	}
+	if runs != 2 {
+		t.Errorf("Tx should retry once, runs: %d.", runs)
+		return
+	}
+	if v, err := set.String(); err != nil || v != "OK" {
+		t.Errorf("Tx set err: %v, reply: %s.", err, v)
+		return
+	}
+
+	// 冲突重试次数用完
+	mu.Lock()
+	conflicts = 10
+	mu.Unlock()
+	err = redisClient.Tx(context.Background(), []string{"field_tx"}, 1, func(tx *Tx) error {
+		tx.SET("field_tx", "1")
+		return nil
+	})
+	if err != ErrTxConflict {
+		t.Errorf("Tx should return conflict, err: %v.", err)
+		return
+	}
+}
@@ -0,0 +1,315 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPubSubHealthCheck = 10 * time.Second
+	defaultPubSubBufferSize  = 100
+	pubSubReconnectMax       = 5 * time.Second
+)
+
+// Publish 发布消息，返回收到消息的订阅者数量
+func (r *Redis) Publish(channel string, msg interface{}) (int, error) {
+	return r.PublishCtx(context.Background(), channel, msg)
+}
+
+// PublishCtx 发布消息，返回收到消息的订阅者数量
+func (r *Redis) PublishCtx(ctx context.Context, channel string, msg interface{}) (int, error) {
+	return redis.Int(r.ExecCommandCtx(ctx, "PUBLISH", channel, msg))
+}
+
+// dialPubSub 新建订阅使用的独立连接（不占用连接池）
+func (r *Redis) dialPubSub(ctx context.Context) (redis.Conn, error) {
+	switch {
+	case r.cluster != nil:
+		// cluster 中PUBLISH 会广播到全部节点，任意节点均可订阅
+		masters := r.cluster.masters()
+		if len(masters) == 0 {
+			return nil, errors.New("[redis]no cluster node available")
+		}
+		cfg := *r.cfg
+		cfg.DatabaseId = 0
+		return dialNode(ctx, &cfg, masters[0])
+	case r.sentinel != nil:
+		return dialNode(ctx, r.cfg, r.sentinel.masterAddr())
+	default:
+		return dialNode(ctx, r.cfg, r.cfg.Address[0])
+	}
+}
+
+// PubSubMessage 订阅收到的消息
+type PubSubMessage struct {
+	Channel string
+	Pattern string // PSUBSCRIBE 匹配的模式，SUBSCRIBE 时为空
+	Data    []byte
+}
+
+// Subscriber 订阅者，连接断开后自动重连并重新订阅全部channel/pattern
+/**
+handler 不为nil 时在接收goroutine 中回调；否则通过Channel() 返回的channel 投递（缓冲区满时阻塞接收）。
+*/
+type Subscriber struct {
+	cli         *Redis
+	handler     func(msg PubSubMessage)
+	msgCh       chan PubSubMessage
+	healthCheck time.Duration
+
+	mu       sync.Mutex // 保护订阅集合以及连接的写操作
+	channels map[string]bool
+	patterns map[string]bool
+	conn     *redis.PubSubConn
+	subCh    chan struct{} // 新增订阅时通知
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSubscriber 新建订阅者，后台goroutine 负责连接、接收消息以及PING 健康检查
+/**
+healthCheck 为PING 间隔，<=0 时默认10s，超过2 个间隔没有收到任何回复视为连接断开。
+*/
+func (r *Redis) NewSubscriber(handler func(msg PubSubMessage), healthCheck time.Duration) *Subscriber {
+	if healthCheck <= 0 {
+		healthCheck = defaultPubSubHealthCheck
+	}
+
+	s := &Subscriber{
+		cli:         r,
+		handler:     handler,
+		healthCheck: healthCheck,
+		channels:    make(map[string]bool),
+		patterns:    make(map[string]bool),
+		subCh:       make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+	}
+	if handler == nil {
+		s.msgCh = make(chan PubSubMessage, defaultPubSubBufferSize)
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Channel 获取消息channel，Close 后关闭（设置了handler 时返回nil）
+func (s *Subscriber) Channel() <-chan PubSubMessage {
+	return s.msgCh
+}
+
+// Subscribe 订阅channel
+func (s *Subscriber) Subscribe(channels ...string) error {
+	return s.update("SUBSCRIBE", s.channels, true, channels)
+}
+
+// Unsubscribe 取消订阅channel
+func (s *Subscriber) Unsubscribe(channels ...string) error {
+	return s.update("UNSUBSCRIBE", s.channels, false, channels)
+}
+
+// PSubscribe 按模式订阅，例如"news.*"
+func (s *Subscriber) PSubscribe(patterns ...string) error {
+	return s.update("PSUBSCRIBE", s.patterns, true, patterns)
+}
+
+// PUnsubscribe 取消按模式订阅
+func (s *Subscriber) PUnsubscribe(patterns ...string) error {
+	return s.update("PUNSUBSCRIBE", s.patterns, false, patterns)
+}
+
+// update 更新订阅集合，已连接时立即发送命令，未连接时在重连后订阅
+func (s *Subscriber) update(command string, set map[string]bool, add bool, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		if add {
+			set[name] = true
+		} else {
+			delete(set, name)
+		}
+		args = append(args, name)
+	}
+
+	if s.conn == nil {
+		if add {
+			select {
+			case s.subCh <- struct{}{}:
+			default:
+			}
+		}
+		return nil
+	}
+	if err := s.conn.Conn.Send(command, args...); err != nil {
+		return err
+	}
+	return s.conn.Conn.Flush()
+}
+
+// Close 停止订阅并关闭连接
+func (s *Subscriber) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+
+		s.mu.Lock()
+		if s.conn != nil {
+			_ = s.conn.Close()
+		}
+		s.mu.Unlock()
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// stopped 是否已关闭
+func (s *Subscriber) stopped() bool {
+	select {
+	case <-s.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// run 连接并接收消息，断开后指数退避重连
+func (s *Subscriber) run() {
+	defer s.wg.Done()
+	defer func() {
+		if s.msgCh != nil {
+			close(s.msgCh)
+		}
+	}()
+
+	backoff := 100 * time.Millisecond
+	for !s.stopped() {
+		start := time.Now()
+		err := s.receive()
+		if s.stopped() {
+			return
+		}
+		logrus.Errorf("[redis]subscriber disconnected, err: %v, reconnect after %v.", err, backoff)
+
+		select {
+		case <-s.stopCh:
+			return
+		case <-time.After(backoff):
+		}
+
+		// 连接存活较久时重置退避时间
+		if time.Since(start) > pubSubReconnectMax {
+			backoff = 100 * time.Millisecond
+		} else if backoff *= 2; backoff > pubSubReconnectMax {
+			backoff = pubSubReconnectMax
+		}
+	}
+}
+
+// empty 是否没有任何订阅
+func (s *Subscriber) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels) == 0 && len(s.patterns) == 0
+}
+
+// receive 建立连接、重新订阅，并持续接收消息直到连接出错
+func (s *Subscriber) receive() error {
+	// 没有任何订阅时不建立连接
+	for s.empty() {
+		select {
+		case <-s.stopCh:
+			return nil
+		case <-s.subCh:
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.healthCheck)
+	conn, err := s.cli.dialPubSub(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	psc := &redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	// 重新订阅全部channel/pattern
+	s.mu.Lock()
+	if s.stopped() {
+		s.mu.Unlock()
+		return nil
+	}
+	for name := range s.channels {
+		_ = psc.Conn.Send("SUBSCRIBE", name)
+	}
+	for name := range s.patterns {
+		_ = psc.Conn.Send("PSUBSCRIBE", name)
+	}
+	if err := psc.Conn.Flush(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.conn = psc
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+	}()
+
+	// 健康检查
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(s.healthCheck)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				err := psc.Ping("")
+				s.mu.Unlock()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		switch v := psc.ReceiveWithTimeout(2 * s.healthCheck).(type) {
+		case redis.Message:
+			s.deliver(PubSubMessage{Channel: v.Channel, Pattern: v.Pattern, Data: v.Data})
+		case redis.Subscription, redis.Pong:
+		case error:
+			return v
+		}
+	}
+}
+
+// deliver 投递消息
+func (s *Subscriber) deliver(msg PubSubMessage) {
+	if s.handler != nil {
+		s.handler(msg)
+		return
+	}
+
+	select {
+	case s.msgCh <- msg:
+	case <-s.stopCh:
+	}
+}
@@ -0,0 +1,88 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscriber(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen err: %v.", err)
+	}
+	defer l.Close()
+
+	// 每个连接订阅后推送一条消息，第一个连接推送后断开，模拟连接中断
+	var conns int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			n := atomic.AddInt32(&conns, 1)
+			go func(c net.Conn) {
+				defer c.Close()
+				br := bufio.NewReader(c)
+				for {
+					args, err := readCommand(br)
+					if err != nil {
+						return
+					}
+					switch args[0] {
+					case "SUBSCRIBE":
+						ch := args[1]
+						fmt.Fprintf(c, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(ch), ch)
+						fmt.Fprintf(c, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\nmsg-%d\r\n", len(ch), ch, len(fmt.Sprint(n))+4, n)
+						if n == 1 {
+							return
+						}
+					case "PING":
+						fmt.Fprint(c, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+					default:
+						fmt.Fprint(c, "+OK\r\n")
+					}
+				}
+			}(c)
+		}
+	}()
+
+	redisClient, err := NewRedis(&RedisConfig{Address: []string{l.Addr().String()}, MaxIdle: 4, MaxActive: 64})
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	sub := redisClient.NewSubscriber(nil, 200*time.Millisecond)
+	if err := sub.Subscribe("test_channel"); err != nil {
+		t.Errorf("Subscribe err: %v.", err)
+		return
+	}
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case msg := <-sub.Channel():
+			if msg.Channel != "test_channel" || string(msg.Data) != fmt.Sprintf("msg-%d", i) {
+				t.Errorf("Subscriber receive unexpected message: %+v.", msg)
+				return
+			}
+		case <-time.After(3 * time.Second):
+			t.Errorf("Subscriber receive message %d timeout.", i)
+			return
+		}
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Errorf("Subscriber close err: %v.", err)
+		return
+	}
+	if _, ok := <-sub.Channel(); ok {
+		t.Errorf("Subscriber channel should be closed.")
+		return
+	}
+}
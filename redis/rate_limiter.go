@@ -0,0 +1,260 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	RateLimitGCRA        = "gcra"         // GCRA（等价于令牌桶），允许burst 突发
+	RateLimitFixedWindow = "fixed_window" // 固定窗口计数
+	RateLimitSlidingLog  = "sliding_log"  // 滑动日志，精确但每个请求占用一个ZSET 成员
+
+	defaultRateLimitPrefix = "RATE:"
+)
+
+/**
+全部脚本使用redis 服务端时间（TIME），避免多个网关之间的时钟偏差；
+返回{是否允许, 剩余次数, retry after（毫秒）, reset after（毫秒）}。
+*/
+
+// gcraScript GCRA
+/**
+KEYS[1]：key
+ARGV[1]：burst，ARGV[2]：period 内允许的次数，ARGV[3]：period（毫秒），ARGV[4]：本次消耗的次数
+*/
+var gcraScript = redis.NewScript(1, `
+	redis.replicate_commands()
+
+	local burst = tonumber(ARGV[1])
+	local rate = tonumber(ARGV[2])
+	local period = tonumber(ARGV[3])
+	local cost = tonumber(ARGV[4])
+
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000 + tonumber(t[2]) / 1000
+
+	local interval = period / rate
+	local tolerance = interval * burst
+
+	local tat = tonumber(redis.call("GET", KEYS[1]))
+	if not tat or tat < now then
+		tat = now
+	end
+
+	local newTat = tat + interval * cost
+	local diff = now - (newTat - tolerance)
+	if diff < 0 then
+		local remaining = math.floor((now - (tat - tolerance)) / interval)
+		return {0, remaining, math.ceil(-diff), math.ceil(tat - now)}
+	end
+
+	local resetAfter = math.ceil(newTat - now)
+	if resetAfter > 0 then
+		redis.call("SET", KEYS[1], string.format("%.3f", newTat), "PX", resetAfter)
+	end
+	return {1, math.floor(diff / interval), 0, resetAfter}
+`)
+
+// fixedWindowScript 固定窗口
+/**
+KEYS[1]：key
+ARGV[1]：窗口内允许的次数，ARGV[2]：窗口大小（毫秒），ARGV[3]：本次消耗的次数
+*/
+var fixedWindowScript = redis.NewScript(1, `
+	local limit = tonumber(ARGV[1])
+	local period = tonumber(ARGV[2])
+	local cost = tonumber(ARGV[3])
+
+	local current = tonumber(redis.call("GET", KEYS[1])) or 0
+	if current + cost > limit then
+		local ttl = redis.call("PTTL", KEYS[1])
+		if ttl < 0 then
+			ttl = period
+		end
+		return {0, limit - current, ttl, ttl}
+	end
+
+	current = redis.call("INCRBY", KEYS[1], cost)
+	local ttl = redis.call("PTTL", KEYS[1])
+	if ttl < 0 then
+		redis.call("PEXPIRE", KEYS[1], period)
+		ttl = period
+	end
+	return {1, limit - current, 0, ttl}
+`)
+
+// slidingLogScript 滑动日志，ZSET 成员为请求，score 为请求时间（微秒）
+/**
+KEYS[1]：key
+ARGV[1]：窗口内允许的次数，ARGV[2]：窗口大小（毫秒），ARGV[3]：本次消耗的次数，ARGV[4]：成员前缀（随机）
+*/
+var slidingLogScript = redis.NewScript(1, `
+	redis.replicate_commands()
+
+	local limit = tonumber(ARGV[1])
+	local period = tonumber(ARGV[2]) * 1000
+	local cost = tonumber(ARGV[3])
+
+	local t = redis.call("TIME")
+	local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+	-- 数字默认只保留14 位有效数字，时间戳需要格式化为字符串
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", string.format("%.0f", now - period))
+	local count = redis.call("ZCARD", KEYS[1])
+
+	if count + cost > limit then
+		local retryAfter = 0
+		if cost <= limit then
+			local idx = count + cost - limit - 1
+			local oldest = redis.call("ZRANGE", KEYS[1], idx, idx, "WITHSCORES")
+			retryAfter = math.ceil((tonumber(oldest[2]) + period - now) / 1000)
+		end
+		local newest = redis.call("ZRANGE", KEYS[1], -1, -1, "WITHSCORES")
+		local resetAfter = 0
+		if #newest > 0 then
+			resetAfter = math.ceil((tonumber(newest[2]) + period - now) / 1000)
+		end
+		return {0, limit - count, retryAfter, resetAfter}
+	end
+
+	for i = 1, cost do
+		redis.call("ZADD", KEYS[1], string.format("%.0f", now), ARGV[4] .. ":" .. i)
+	end
+	redis.call("PEXPIRE", KEYS[1], math.ceil(period / 1000))
+	return {1, limit - count - cost, 0, math.ceil(period / 1000)}
+`)
+
+// RateLimitResult 限流结果
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int64         // 剩余可用次数
+	RetryAfter time.Duration // 被拒绝时需要等待的时间，-1 表示本次请求的次数超过上限，永远不会被允许
+	ResetAfter time.Duration // 恢复到满额需要的时间
+}
+
+// RateLimiterOption RateLimiter 额外参数
+type RateLimiterOption func(l *RateLimiter)
+
+// RateLimiterWithBurst 设置GCRA 允许的突发次数，默认等于limit
+func RateLimiterWithBurst(burst int64) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.burst = burst
+	}
+}
+
+// RateLimiterWithPrefix 设置key 前缀，默认"RATE:"
+func RateLimiterWithPrefix(prefix string) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.prefix = prefix
+	}
+}
+
+// RateLimiter 分布式限流器，每次判断在lua 脚本中原子完成
+type RateLimiter struct {
+	cli       *Redis
+	algorithm string
+	limit     int64
+	period    time.Duration
+	burst     int64
+	prefix    string
+}
+
+// NewRateLimiter 新建限流器，每个key 在period 内最多允许limit 次
+/**
+algorithm 参考RateLimit* 常量。
+*/
+func NewRateLimiter(client *Redis, algorithm string, limit int64, period time.Duration, options ...RateLimiterOption) (*RateLimiter, error) {
+	if client == nil {
+		return nil, errors.New("[redis]client is nil")
+	}
+	if limit <= 0 || period < time.Millisecond {
+		return nil, errors.New("[redis]rate limit and period must be positive")
+	}
+	switch algorithm {
+	case RateLimitGCRA, RateLimitFixedWindow, RateLimitSlidingLog:
+	default:
+		return nil, fmt.Errorf("[redis]unknown rate limit algorithm '%s'", algorithm)
+	}
+
+	l := &RateLimiter{
+		cli:       client,
+		algorithm: algorithm,
+		limit:     limit,
+		period:    period,
+		burst:     limit,
+		prefix:    defaultRateLimitPrefix,
+	}
+	for _, f := range options {
+		f(l)
+	}
+	if l.burst <= 0 {
+		l.burst = limit
+	}
+	return l, nil
+}
+
+// Allow 判断key 是否允许消耗n 次
+func (l *RateLimiter) Allow(ctx context.Context, key string, n int64) (*RateLimitResult, error) {
+	if n <= 0 {
+		return nil, errors.New("[redis]rate limit n must be positive")
+	}
+
+	key = l.prefix + key
+	period := l.period.Milliseconds()
+
+	var (
+		reply interface{}
+		err   error
+	)
+	switch l.algorithm {
+	case RateLimitGCRA:
+		reply, err = l.cli.ExecScriptCtx(ctx, gcraScript, key, l.burst, l.limit, period, n)
+	case RateLimitFixedWindow:
+		reply, err = l.cli.ExecScriptCtx(ctx, fixedWindowScript, key, l.limit, period, n)
+	default:
+		reply, err = l.cli.ExecScriptCtx(ctx, slidingLogScript, key, l.limit, period, n, uuid.NewV4().String())
+	}
+
+	values, err := redis.Int64s(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 4 {
+		return nil, errors.New("[redis]invalid rate limit reply")
+	}
+
+	res := &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Remaining:  values[1],
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}
+	// 单次请求的次数超过上限时永远不会被允许
+	if !res.Allowed && n > l.capacity() {
+		res.RetryAfter = -1
+	}
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	return res, nil
+}
+
+// capacity 单次请求允许的最大次数
+func (l *RateLimiter) capacity() int64 {
+	if l.algorithm == RateLimitGCRA {
+		return l.burst
+	}
+	return l.limit
+}
+
+// Reset 清除key 的限流状态
+func (l *RateLimiter) Reset(ctx context.Context, key string) error {
+	_, err := l.cli.DELCtx(ctx, l.prefix+key)
+	return err
+}
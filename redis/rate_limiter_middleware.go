@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+/**
+中间件每个请求消耗1 次；redis 出错时放行请求（fail open）并打印错误日志，避免redis 故障导致服务不可用。
+*/
+
+// HTTPKeyFunc 获取http 请求的限流key
+type HTTPKeyFunc func(r *http.Request) string
+
+// GRPCKeyFunc 获取gRPC 请求的限流key
+type GRPCKeyFunc func(ctx context.Context, fullMethod string) string
+
+// RateLimitHandler net/http 限流中间件，超过限流时返回429
+/**
+keyFunc 为nil 时按照客户端IP 限流。
+*/
+func RateLimitHandler(l *RateLimiter, keyFunc HTTPKeyFunc, next http.Handler) http.Handler {
+	if keyFunc == nil {
+		keyFunc = remoteIP
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := l.Allow(r.Context(), keyFunc(r), 1)
+		if err != nil {
+			logrus.Errorf("[redis]rate limit err: %v.", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+		if !res.Allowed {
+			if res.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(res.RetryAfter.Seconds())), 10))
+			}
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remoteIP 获取http 请求的客户端IP
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimitUnaryServerInterceptor gRPC unary 限流拦截器，超过限流时返回codes.ResourceExhausted
+/**
+keyFunc 为nil 时按照"方法名:客户端IP" 限流。
+*/
+func RateLimitUnaryServerInterceptor(l *RateLimiter, keyFunc GRPCKeyFunc) grpc.UnaryServerInterceptor {
+	if keyFunc == nil {
+		keyFunc = peerKey
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := grpcAllow(ctx, l, keyFunc(ctx, info.FullMethod)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamServerInterceptor gRPC stream 限流拦截器，建立stream 时消耗1 次
+func RateLimitStreamServerInterceptor(l *RateLimiter, keyFunc GRPCKeyFunc) grpc.StreamServerInterceptor {
+	if keyFunc == nil {
+		keyFunc = peerKey
+	}
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := grpcAllow(ss.Context(), l, keyFunc(ss.Context(), info.FullMethod)); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// grpcAllow 判断gRPC 请求是否允许
+func grpcAllow(ctx context.Context, l *RateLimiter, key string) error {
+	res, err := l.Allow(ctx, key, 1)
+	if err != nil {
+		logrus.Errorf("[redis]rate limit err: %v.", err)
+		return nil
+	}
+	if !res.Allowed {
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %v", res.RetryAfter)
+	}
+	return nil
+}
+
+// peerKey 获取gRPC 请求的默认限流key
+func peerKey(ctx context.Context, fullMethod string) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return fullMethod
+	}
+
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return fullMethod + ":" + addr
+}
@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	// 获取Redis
+	var cfg = &RedisConfig{
+		Password:       "yZY0G0Dzh5N",
+		Address:        []string{"10.171.5.193:6382"},
+		DatabaseId:     0,
+		MaxIdle:        4,
+		MaxActive:      64,
+		IdleTimeout:    time.Duration(5000) * time.Millisecond,
+		ConnectTimeout: time.Duration(5000) * time.Millisecond,
+		ReadTimeout:    time.Duration(5000) * time.Millisecond,
+		WriteTimeout:   time.Duration(180) * time.Second,
+	}
+
+	redisClient, err := NewRedis(cfg)
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	ctx := context.Background()
+	for _, algorithm := range []string{RateLimitGCRA, RateLimitFixedWindow, RateLimitSlidingLog} {
+		limiter, err := NewRateLimiter(redisClient, algorithm, 5, time.Second)
+		if err != nil {
+			t.Errorf("New rate limiter err: %v.", err)
+			return
+		}
+		_ = limiter.Reset(ctx, "test_rate_limiter")
+
+		// period 内前5 次允许，第6 次拒绝
+		for i := 0; i < 6; i++ {
+			res, err := limiter.Allow(ctx, "test_rate_limiter", 1)
+			if err != nil {
+				t.Errorf("Rate limiter '%s' allow err: %v.", algorithm, err)
+				return
+			}
+			if res.Allowed != (i < 5) {
+				t.Errorf("Rate limiter '%s' request %d result: %+v.", algorithm, i, res)
+				return
+			}
+			t.Logf("%s: %+v", algorithm, res)
+		}
+		_ = limiter.Reset(ctx, "test_rate_limiter")
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	// 脚本固定返回拒绝，retry after 1500ms
+	addr := fakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "EVALSHA":
+			return "*4\r\n:0\r\n:0\r\n:1500\r\n:1500\r\n"
+		default:
+			return "+OK\r\n"
+		}
+	})
+
+	redisClient, err := NewRedis(&RedisConfig{Address: []string{addr}, MaxIdle: 4, MaxActive: 64})
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	limiter, err := NewRateLimiter(redisClient, RateLimitGCRA, 5, time.Second)
+	if err != nil {
+		t.Errorf("New rate limiter err: %v.", err)
+		return
+	}
+
+	handler := RateLimitHandler(limiter, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("Rate limit handler unexpected response: %d, %v.", w.Code, w.Header())
+		return
+	}
+}
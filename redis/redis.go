@@ -1,8 +1,8 @@
 package redis
 
 import (
+	"context"
 	"errors"
-	"github.com/FZambia/sentinel"
 	"github.com/gomodule/redigo/redis"
 	"github.com/vmihailenco/msgpack/v4"
 	"reflect"
@@ -20,11 +20,36 @@ type RedisConfig struct {
 	ReadTimeout    time.Duration `json:"read_timeout"`
 	WriteTimeout   time.Duration `json:"write_timeout"`
 
+	// Deprecated: 历史哨兵配置，等同于Mode 为sentinel、MasterName 为"mymaster"、哨兵地址为Address
 	IsCluster bool `json:"is_cluster"`
+
+	Mode         string `json:"mode"`          // 部署模式，默认standalone，参考Mode* 常量
+	MaxRedirects int    `json:"max_redirects"` // cluster 模式下MOVED/ASK 最大重定向次数，默认3
+
+	MasterName            string        `json:"master_name"`             // sentinel 模式下master 名称
+	SentinelAddrs         []string      `json:"sentinel_addrs"`          // sentinel 地址，为空时使用Address
+	SentinelPassword      string        `json:"sentinel_password"`       // sentinel 密码
+	SentinelCheckInterval time.Duration `json:"sentinel_check_interval"` // 检测master 切换的间隔，默认1s
+	ReadFromReplica       bool          `json:"read_from_replica"`       // sentinel 模式下只读命令是否发送到replica
+
+	Codec             string `json:"codec"`              // SetObject/GetObject 使用的codec，默认msgpack，参考Codec* 常量
+	Compression       string `json:"compression"`        // 压缩算法，默认不压缩，参考Compression* 常量
+	CompressThreshold int    `json:"compress_threshold"` // 序列化后超过该字节数时压缩，默认1024
 }
 
+const (
+	ModeStandalone = "standalone" // 单机模式
+	ModeCluster    = "cluster"    // Redis Cluster 模式，根据CLUSTER SLOTS 路由命令
+	ModeSentinel   = "sentinel"   // Redis Sentinel 模式，根据哨兵获取master 地址
+)
+
 type Redis struct {
-	redisPool *redis.Pool
+	cfg         *RedisConfig
+	redisPool   *redis.Pool // sentinel 模式下为nil，使用sentinel.masterPool()
+	replicaPool *redis.Pool // sentinel 模式下只读命令使用的replica 连接池
+	cluster     *cluster
+	sentinel    *sentinelClient
+	codec       *objectCodec
 }
 
 // NewRedis 新建redis
@@ -33,64 +58,95 @@ func NewRedis(cfg *RedisConfig) (*Redis, error) {
 		return nil, errors.New("[redis]cfg is nil")
 	}
 
-	redisPool := &redis.Pool{
-		MaxIdle:     cfg.MaxIdle,
-		MaxActive:   cfg.MaxActive,
-		IdleTimeout: cfg.IdleTimeout,
-		Dial: func() (redis.Conn, error) {
-			c, err := wrapDial(cfg)
-			if err != nil {
-				return nil, err
-			}
-
-			if _, err := c.Do("AUTH", cfg.Password); err != nil {
-				c.Close()
-				return nil, err
-			}
-			_, err = c.Do("SELECT", cfg.DatabaseId)
-			if err != nil {
-				return nil, err
-			}
-			return c, nil
-		},
+	codec, err := newObjectCodec(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := cfg.Mode
+	if mode == "" && cfg.IsCluster {
+		mode = ModeSentinel
 	}
 
-	return &Redis{redisPool: redisPool}, nil
-}
-
-// Redis dial
-func wrapDial(cfg *RedisConfig) (redis.Conn, error) {
-	redisAddr := cfg.Address[0]
-	if cfg.IsCluster {
-		sntnl := &sentinel.Sentinel{
-			Addrs:      cfg.Address,
-			MasterName: "mymaster",
-			Dial: func(addr string) (redis.Conn, error) {
-				// dial 是每次轮询的时候查询的dial，所以是否需要添加后续的timeout 暂未可知，后续再整理
-				c, err := redis.Dial("tcp", addr, redis.DialConnectTimeout(cfg.ConnectTimeout),
-					redis.DialReadTimeout(cfg.ReadTimeout),
-					redis.DialWriteTimeout(cfg.WriteTimeout))
-				if err != nil {
-					return nil, err
-				}
-				return c, nil
-			},
+	switch mode {
+	case ModeCluster:
+		c, err := newCluster(cfg)
+		if err != nil {
+			return nil, err
 		}
-		var err error
-		redisAddr, err = sntnl.MasterAddr()
+		return &Redis{cfg: cfg, cluster: c, codec: codec}, nil
+
+	case ModeSentinel:
+		s, err := newSentinelClient(cfg)
 		if err != nil {
 			return nil, err
 		}
+		r := &Redis{cfg: cfg, sentinel: s, codec: codec}
+		if cfg.ReadFromReplica {
+			r.replicaPool = s.newReplicaPool()
+		}
+		return r, nil
+	}
+
+	if len(cfg.Address) == 0 {
+		return nil, errors.New("[redis]address is empty")
+	}
+
+	redisPool := &redis.Pool{
+		MaxIdle:     cfg.MaxIdle,
+		MaxActive:   cfg.MaxActive,
+		IdleTimeout: cfg.IdleTimeout,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return dialNode(ctx, cfg, cfg.Address[0])
+		},
 	}
 
-	return redis.Dial("tcp", redisAddr, redis.DialConnectTimeout(cfg.ConnectTimeout),
+	return &Redis{cfg: cfg, redisPool: redisPool, codec: codec}, nil
+}
+
+// dialNode 连接节点并完成AUTH、SELECT
+func dialNode(ctx context.Context, cfg *RedisConfig, addr string) (redis.Conn, error) {
+	c, err := redis.DialContext(ctx, "tcp", addr, redis.DialConnectTimeout(cfg.ConnectTimeout),
 		redis.DialReadTimeout(cfg.ReadTimeout),
 		redis.DialWriteTimeout(cfg.WriteTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := redis.DoContext(c, ctx, "AUTH", cfg.Password); err != nil {
+		c.Close()
+		return nil, err
+	}
+	_, err = redis.DoContext(c, ctx, "SELECT", cfg.DatabaseId)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &nodeConn{Conn: c, addr: addr}, nil
 }
 
 // GetClient 获取client
+/**
+cluster 模式下返回的client 会根据命令的key 路由到对应节点。
+*/
 func (r *Redis) GetClient() redis.Conn {
-	return r.redisPool.Get()
+	return r.getConn()
+}
+
+// getConn 根据部署模式获取连接
+func (r *Redis) getConn() redis.Conn {
+	if r.cluster != nil {
+		return r.cluster.get()
+	}
+	return r.pool().Get()
+}
+
+// pool 获取连接池，sentinel 模式下为当前master 的连接池
+func (r *Redis) pool() *redis.Pool {
+	if r.sentinel != nil {
+		return r.sentinel.masterPool()
+	}
+	return r.redisPool
 }
 
 // CloseClient 关闭从pool 获取的client
@@ -101,9 +157,41 @@ func (r *Redis) CloseClient(rc redis.Conn) error {
 	return nil
 }
 
-// GetPool 获取pool
+// GetPool 获取pool（cluster 模式下为nil，sentinel 模式下为当前master 连接池，master 切换后会被关闭并替换，不要长期持有）
 func (r *Redis) GetPool() *redis.Pool {
-	return r.redisPool
+	if r.cluster != nil {
+		return nil
+	}
+	return r.pool()
+}
+
+// MasterAddr 获取sentinel 模式下当前master 地址（非sentinel 模式返回空）
+func (r *Redis) MasterAddr() string {
+	if r.sentinel == nil {
+		return ""
+	}
+	return r.sentinel.masterAddr()
+}
+
+// IsClusterMode 是否为Redis Cluster 模式
+func (r *Redis) IsClusterMode() bool {
+	return r.cluster != nil
+}
+
+// ClusterMasters 获取cluster 全部master 节点地址（非cluster 模式返回nil）
+func (r *Redis) ClusterMasters() []string {
+	if r.cluster == nil {
+		return nil
+	}
+	return r.cluster.masters()
+}
+
+// RefreshCluster 刷新cluster 槽位映射
+func (r *Redis) RefreshCluster() error {
+	if r.cluster == nil {
+		return nil
+	}
+	return r.cluster.refresh()
 }
 
 // ClosePool 关闭pool
@@ -111,27 +199,43 @@ func (r *Redis) ClosePool() {
 	if r.redisPool != nil {
 		r.redisPool.Close()
 	}
+	if r.replicaPool != nil {
+		r.replicaPool.Close()
+	}
+	if r.sentinel != nil {
+		r.sentinel.close()
+	}
+	if r.cluster != nil {
+		r.cluster.close()
+	}
 }
 
 // ExecCommand 执行command 命令
+/**
+sentinel 模式下开启ReadFromReplica 时，只读命令会发送到replica（可能读到复制延迟前的旧数据）。
+*/
 func (r *Redis) ExecCommand(command string, args ...interface{}) (interface{}, error) {
-	rc := r.redisPool.Get()
+	rc := r.getConnForCommand(command)
 	defer rc.Close()
 
 	return rc.Do(command, args...)
 }
 
+// getConnForCommand 根据命令获取连接（只读命令在开启ReadFromReplica 时使用replica）
+func (r *Redis) getConnForCommand(command string) redis.Conn {
+	if r.replicaPool != nil && isReadOnlyCommand(command) {
+		return r.replicaPool.Get()
+	}
+	return r.getConn()
+}
+
 // SetExpWithMP 存储struct，操作带有过期时间（毫秒）
+/**
+固定使用msgpack，需要其他序列化方式或者压缩时使用SetObject。
+*/
 func (r *Redis) SetExpWithMP(key string, value interface{}, expireMilliseconds int) error {
-	v := reflect.ValueOf(value)
-	k := v.Kind()
-	if k != reflect.Ptr {
-		return errors.New("[redis]value must be a pointer to a struct")
-	}
-	v = v.Elem()
-	k = v.Kind()
-	if k != reflect.Struct {
-		return errors.New("[redis]value must be a pointer to a struct")
+	if err := checkStructPtr(value); err != nil {
+		return err
 	}
 
 	b, err := msgpack.Marshal(value)
@@ -143,7 +247,23 @@ func (r *Redis) SetExpWithMP(key string, value interface{}, expireMilliseconds i
 }
 
 // GetWithMP 根据key 获取struct
+/**
+固定使用msgpack，需要其他序列化方式或者压缩时使用GetObject。
+*/
 func (r *Redis) GetWithMP(key string, value interface{}) error {
+	if err := checkStructPtr(value); err != nil {
+		return err
+	}
+
+	b, err := redis.Bytes(r.ExecCommand("GET", key))
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(b, value)
+}
+
+// checkStructPtr 校验value 是否为结构体指针
+func checkStructPtr(value interface{}) error {
 	v := reflect.ValueOf(value)
 	k := v.Kind()
 	if k != reflect.Ptr {
@@ -154,22 +274,15 @@ func (r *Redis) GetWithMP(key string, value interface{}) error {
 	if k != reflect.Struct {
 		return errors.New("[redis]value must be a pointer to a struct")
 	}
-
-	b, err := redis.Bytes(r.ExecCommand("GET", key))
-	if err != nil {
-		return err
-	}
-	return msgpack.Unmarshal(b, value)
+	return nil
 }
 
 // MGET 方法
+/**
+cluster 模式下会将keys 按照槽位拆分为多次MGET，结果顺序与keys 保持一致。
+*/
 func (r *Redis) MGET(keys []string) ([][]byte, error) {
-	cfgs := make([]interface{}, len(keys))
-	for i := range keys {
-		cfgs[i] = keys[i]
-	}
-
-	return redis.ByteSlices(r.ExecCommand("MGET", cfgs...))
+	return r.MGETCtx(context.Background(), keys)
 }
 
 // SET 方法
@@ -180,24 +293,16 @@ SET 设置键来保存字符串值。
 	[NOTE] 由于SET 命令选项可以替换SETNX、SETEX、PSETEX、GETSET，因此在未来的Redis 版本中，这些命令可能会被弃用并最终被删除。
 */
 func (r *Redis) SET(key string, value interface{}, options ...SetOption) (string, error) {
-	args := setArgs{key, value}
-	for _, f := range options {
-		args = f(args)
-	}
-
-	return redis.String(r.ExecCommand("SET", args...))
+	return redis.String(r.ExecCommand("SET", buildSetArgs(key, value, options)...))
 }
 
 // DEL 方法
 /**
 DEL 删除指定的键。如果键不存在，则忽略该键。
+cluster 模式下会将keys 按照槽位拆分为多次DEL。
 */
 func (r *Redis) DEL(keys ...string) (int, error) {
-	ikeys := make([]interface{}, 0, len(keys))
-	for _, key := range keys {
-		ikeys = append(ikeys, key)
-	}
-	return redis.Int(r.ExecCommand("DEL", ikeys...))
+	return r.DELCtx(context.Background(), keys...)
 }
 
 // EXISTS 方法
@@ -264,6 +369,8 @@ KEYS 返回所有匹配模式的键。
      h[^e]llo matches hallo, hbllo, ... but not hello
      h[a-b]llo matches hallo and hbllo
  Use \ to escape special characters if you want to match them verbatim.
+
+Deprecated: KEYS 会阻塞redis，使用Scan 迭代或者DeleteByPattern 批量删除。
 */
 func (r *Redis) KEYS(key string) ([]string, error) {
 	return redis.Strings(r.ExecCommand("KEYS", key))
@@ -0,0 +1,236 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+/**
+...Ctx 系列方法与同名方法语义一致，区别在于：
+	1. 从连接池获取连接时使用Pool.GetContext，ctx 取消时不再等待空闲连接；
+	2. 执行命令时使用redis.DoContext，ctx 取消或超时后立即返回，对应连接会被关闭而不会放回连接池。
+ctx 的deadline 大于ReadTimeout 时，仍以ReadTimeout 为准。
+*/
+
+// GetClientCtx 获取client，ctx 取消时不再等待连接池
+func (r *Redis) GetClientCtx(ctx context.Context) (redis.Conn, error) {
+	return r.getConnContext(ctx)
+}
+
+// getConnContext 根据部署模式获取连接
+func (r *Redis) getConnContext(ctx context.Context) (redis.Conn, error) {
+	if r.cluster != nil {
+		return r.cluster.getContext(ctx), nil
+	}
+	return r.pool().GetContext(ctx)
+}
+
+// getConnForCommandContext 根据命令获取连接（只读命令在开启ReadFromReplica 时使用replica）
+func (r *Redis) getConnForCommandContext(ctx context.Context, command string) (redis.Conn, error) {
+	if r.replicaPool != nil && isReadOnlyCommand(command) {
+		return r.replicaPool.GetContext(ctx)
+	}
+	return r.getConnContext(ctx)
+}
+
+// ExecCommandCtx 执行command 命令
+func (r *Redis) ExecCommandCtx(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	rc, err := r.getConnForCommandContext(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return redis.DoContext(rc, ctx, command, args...)
+}
+
+// SetExpWithMPCtx 存储struct，操作带有过期时间（毫秒）
+func (r *Redis) SetExpWithMPCtx(ctx context.Context, key string, value interface{}, expireMilliseconds int) error {
+	if err := checkStructPtr(value); err != nil {
+		return err
+	}
+
+	b, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = r.ExecCommandCtx(ctx, "SET", key, b, "PX", expireMilliseconds)
+	return err
+}
+
+// GetWithMPCtx 根据key 获取struct
+func (r *Redis) GetWithMPCtx(ctx context.Context, key string, value interface{}) error {
+	if err := checkStructPtr(value); err != nil {
+		return err
+	}
+
+	b, err := redis.Bytes(r.ExecCommandCtx(ctx, "GET", key))
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(b, value)
+}
+
+// MGETCtx 方法
+/**
+cluster 模式下会将keys 按照槽位拆分为多次MGET，结果顺序与keys 保持一致。
+*/
+func (r *Redis) MGETCtx(ctx context.Context, keys []string) ([][]byte, error) {
+	if r.cluster != nil {
+		groups, indexes := splitBySlot(keys)
+		values := make([][]byte, len(keys))
+		for g := range groups {
+			vs, err := r.mget(ctx, groups[g])
+			if err != nil {
+				return nil, err
+			}
+			for i := range vs {
+				values[indexes[g][i]] = vs[i]
+			}
+		}
+		return values, nil
+	}
+
+	return r.mget(ctx, keys)
+}
+
+func (r *Redis) mget(ctx context.Context, keys []string) ([][]byte, error) {
+	cfgs := make([]interface{}, len(keys))
+	for i := range keys {
+		cfgs[i] = keys[i]
+	}
+
+	return redis.ByteSlices(r.ExecCommandCtx(ctx, "MGET", cfgs...))
+}
+
+// SETCtx 方法
+func (r *Redis) SETCtx(ctx context.Context, key string, value interface{}, options ...SetOption) (string, error) {
+	return redis.String(r.ExecCommandCtx(ctx, "SET", buildSetArgs(key, value, options)...))
+}
+
+// DELCtx 方法
+/**
+cluster 模式下会将keys 按照槽位拆分为多次DEL。
+*/
+func (r *Redis) DELCtx(ctx context.Context, keys ...string) (int, error) {
+	if r.cluster != nil {
+		groups, _ := splitBySlot(keys)
+		total := 0
+		for _, group := range groups {
+			n, err := r.del(ctx, group)
+			if err != nil {
+				return total, err
+			}
+			total += n
+		}
+		return total, nil
+	}
+
+	return r.del(ctx, keys)
+}
+
+func (r *Redis) del(ctx context.Context, keys []string) (int, error) {
+	ikeys := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		ikeys = append(ikeys, key)
+	}
+	return redis.Int(r.ExecCommandCtx(ctx, "DEL", ikeys...))
+}
+
+// EXISTSCtx 方法
+func (r *Redis) EXISTSCtx(ctx context.Context, key string) (int, error) {
+	return redis.Int(r.ExecCommandCtx(ctx, "EXISTS", key))
+}
+
+// PEXPIRECtx 方法
+func (r *Redis) PEXPIRECtx(ctx context.Context, key string, milliseconds int) (int, error) {
+	return redis.Int(r.ExecCommandCtx(ctx, "PEXPIRE", key, milliseconds))
+}
+
+// EXPIRECtx 方法
+func (r *Redis) EXPIRECtx(ctx context.Context, key string, seconds int) (int, error) {
+	return redis.Int(r.ExecCommandCtx(ctx, "EXPIRE", key, seconds))
+}
+
+// PEXPIREATCtx 方法
+func (r *Redis) PEXPIREATCtx(ctx context.Context, key string, millisecondsTimestamp int64) (int, error) {
+	return redis.Int(r.ExecCommandCtx(ctx, "PEXPIREAT", key, millisecondsTimestamp))
+}
+
+// PTTLCtx 方法
+func (r *Redis) PTTLCtx(ctx context.Context, key string) (int, error) {
+	return redis.Int(r.ExecCommandCtx(ctx, "PTTL", key))
+}
+
+// GETCtx 方法
+func (r *Redis) GETCtx(ctx context.Context, key string) (string, error) {
+	return redis.String(r.ExecCommandCtx(ctx, "GET", key))
+}
+
+// KEYSCtx 方法
+/**
+[Warning]：KEYS 会阻塞redis，不要在常规应用程序代码中使用。
+
+Deprecated: 使用Scan 迭代或者DeleteByPattern 批量删除。
+*/
+func (r *Redis) KEYSCtx(ctx context.Context, key string) ([]string, error) {
+	return redis.Strings(r.ExecCommandCtx(ctx, "KEYS", key))
+}
+
+// BRPOPCtx 方法
+/**
+ctx 取消时立即返回，不必等待expireTimeSeconds 到期。
+*/
+func (r *Redis) BRPOPCtx(ctx context.Context, key string, expireTimeSeconds int64) ([]string, error) {
+	return redis.Strings(r.ExecCommandCtx(ctx, "BRPOP", key, expireTimeSeconds))
+}
+
+// LPUSHCtx 方法
+func (r *Redis) LPUSHCtx(ctx context.Context, key, value string) (int, error) {
+	return redis.Int(r.ExecCommandCtx(ctx, "LPUSH", key, value))
+}
+
+// RPOPCtx 方法
+func (r *Redis) RPOPCtx(ctx context.Context, key string) (string, error) {
+	return redis.String(r.ExecCommandCtx(ctx, "RPOP", key))
+}
+
+// TryGetLockCtx 扩展NX 实现锁，该锁是非阻塞的
+func (r *Redis) TryGetLockCtx(ctx context.Context, key, value string, expireTimeSeconds int64) (bool, error) {
+	ok, err := r.SETCtx(ctx, key, value, SetWithEX(int(expireTimeSeconds)), SetWithNX())
+	if ok == "OK" && err == nil {
+		return true, nil
+	}
+	return false, err
+}
+
+// WaitForGetLockCtx 等待获取锁，ctx 取消时立即返回
+func (r *Redis) WaitForGetLockCtx(ctx context.Context, waitKey string, expireTimeSeconds int64) (bool, error) {
+	_, err := r.BRPOPCtx(ctx, waitKey, expireTimeSeconds)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseLockAndRpushCtx 释放锁并且重新添加
+func (r *Redis) ReleaseLockAndRpushCtx(ctx context.Context, key, waitKey, value string) error {
+	_, err := r.ExecScriptCtx(ctx, deleteAndRPUSHScript, key, waitKey, value)
+	return err
+}
+
+// ExecScriptCtx 执行lua 脚本（优先EVALSHA，脚本未加载时自动EVAL）
+/**
+cluster 模式下脚本的全部key 需要位于同一槽位（可使用hash tag）。
+*/
+func (r *Redis) ExecScriptCtx(ctx context.Context, script *redis.Script, keysAndArgs ...interface{}) (interface{}, error) {
+	rc, err := r.getConnContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return script.DoContext(ctx, rc, keysAndArgs...)
+}
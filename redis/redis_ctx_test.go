@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeServer 简易RESP 服务端，handler 返回空字符串时不回复
+func fakeServer(t *testing.T, handler func(args []string) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen err: %v.", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				br := bufio.NewReader(c)
+				for {
+					args, err := readCommand(br)
+					if err != nil {
+						return
+					}
+					if reply := handler(args); reply != "" {
+						if _, err := c.Write([]byte(reply)); err != nil {
+							return
+						}
+					}
+				}
+			}(c)
+		}
+	}()
+	return l.Addr().String()
+}
+
+// readCommand 读取RESP 数组格式的命令
+func readCommand(br *bufio.Reader) ([]string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err := br.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg[:len(arg)-2])
+	}
+	return args, nil
+}
+
+func TestExecCommandCtx(t *testing.T) {
+	addr := fakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "AUTH", "SELECT":
+			return "+OK\r\n"
+		case "GET":
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(args[1]), args[1])
+		}
+		// 其他命令不回复，模拟慢redis
+		return ""
+	})
+
+	redisClient, err := NewRedis(&RedisConfig{
+		Address:   []string{addr},
+		MaxIdle:   4,
+		MaxActive: 64,
+	})
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	val, err := redisClient.GETCtx(context.Background(), "field_ctx")
+	if err != nil || val != "field_ctx" {
+		t.Errorf("Redis get ctx err: %v, reply: %s.", err, val)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err = redisClient.BRPOPCtx(ctx, "list_ctx", 0); err == nil {
+		t.Errorf("Redis brpop ctx should return err.")
+		return
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("Redis brpop ctx cost too long: %v.", cost)
+		return
+	}
+	t.Log(err)
+}
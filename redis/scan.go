@@ -0,0 +1,259 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// scan 参数列表
+type scanArgs []interface{}
+
+// ScanOption SCAN/HSCAN/ZSCAN/SSCAN 额外参数
+type ScanOption func(args scanArgs) scanArgs
+
+// ScanWithMatch
+/**
+只返回匹配glob 模式的元素，匹配在取出元素之后进行，因此一次迭代可能返回空结果。
+*/
+func ScanWithMatch(pattern string) ScanOption {
+	return func(args scanArgs) scanArgs {
+		return append(args, "MATCH", pattern)
+	}
+}
+
+// ScanWithCount
+/**
+每次迭代期望返回的元素数量，默认10。
+*/
+func ScanWithCount(count int) ScanOption {
+	return func(args scanArgs) scanArgs {
+		return append(args, "COUNT", count)
+	}
+}
+
+// ScanWithType
+/**
+只返回指定类型的key（string、list、set、zset、hash、stream），仅SCAN 支持。
+>= 6.0
+*/
+func ScanWithType(keyType string) ScanOption {
+	return func(args scanArgs) scanArgs {
+		return append(args, "TYPE", keyType)
+	}
+}
+
+// ScanIterator 基于游标的迭代器，不会像KEYS 一样阻塞redis
+/**
+使用方式：
+	it := r.Scan(ScanWithMatch("user:*"))
+	for it.Next(ctx) {
+		key := it.Val()
+	}
+	if err := it.Err(); err != nil {}
+迭代期间一直存在的元素至少返回一次，但可能重复返回。
+游标依赖具体节点，因此迭代始终在master 上进行，不会使用replica。
+*/
+type ScanIterator struct {
+	cli     *Redis
+	command string
+	key     string // HSCAN/ZSCAN/SSCAN 的key
+	args    scanArgs
+
+	nodes  []string // cluster 模式下SCAN 依次迭代的master 节点
+	node   int
+	cursor string
+	done   bool
+	buf    []string
+	pos    int
+	val    string
+	err    error
+}
+
+// Scan 迭代当前数据库的key，cluster 模式下依次迭代全部master 节点
+func (r *Redis) Scan(options ...ScanOption) *ScanIterator {
+	it := r.newScanIterator("SCAN", "", options)
+	if r.cluster != nil {
+		it.nodes = r.cluster.masters()
+		if len(it.nodes) == 0 {
+			it.err = errors.New("[redis]no cluster node available")
+		}
+	}
+	return it
+}
+
+// HScan 迭代hash 的field 与value，Val() 依次返回field、value
+func (r *Redis) HScan(key string, options ...ScanOption) *ScanIterator {
+	return r.newScanIterator("HSCAN", key, options)
+}
+
+// ZScan 迭代zset 的member 与score，Val() 依次返回member、score
+func (r *Redis) ZScan(key string, options ...ScanOption) *ScanIterator {
+	return r.newScanIterator("ZSCAN", key, options)
+}
+
+// SScan 迭代set 的member
+func (r *Redis) SScan(key string, options ...ScanOption) *ScanIterator {
+	return r.newScanIterator("SSCAN", key, options)
+}
+
+func (r *Redis) newScanIterator(command, key string, options []ScanOption) *ScanIterator {
+	var args scanArgs
+	for _, f := range options {
+		args = f(args)
+	}
+	return &ScanIterator{cli: r, command: command, key: key, args: args, cursor: "0"}
+}
+
+// Next 获取下一个元素，没有更多元素或者出错时返回false
+func (it *ScanIterator) Next(ctx context.Context) bool {
+	for it.pos >= len(it.buf) {
+		if it.done || it.err != nil {
+			return false
+		}
+		if err := it.fetch(ctx); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	it.val = it.buf[it.pos]
+	it.pos++
+	return true
+}
+
+// Val 获取当前元素
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+// Err 获取迭代过程中的错误
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// fetch 执行一次迭代
+func (it *ScanIterator) fetch(ctx context.Context) error {
+	args := make([]interface{}, 0, len(it.args)+2)
+	if it.key != "" {
+		args = append(args, it.key)
+	}
+	args = append(args, it.cursor)
+	args = append(args, it.args...)
+
+	rc, err := it.conn(ctx)
+	if err != nil {
+		return err
+	}
+	values, err := redis.Values(redis.DoContext(rc, ctx, it.command, args...))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if len(values) != 2 {
+		return errors.New("[redis]invalid scan reply")
+	}
+
+	cursor, err := redis.String(values[0], nil)
+	if err != nil {
+		return err
+	}
+	if it.buf, err = redis.Strings(values[1], nil); err != nil {
+		return err
+	}
+	it.pos = 0
+
+	// 当前节点迭代完成，cluster 模式下继续迭代下一个节点
+	it.cursor = cursor
+	if cursor == "0" {
+		it.node++
+		if it.node >= len(it.nodes) {
+			it.done = true
+		}
+	}
+	return nil
+}
+
+// conn 获取当前迭代节点的连接
+func (it *ScanIterator) conn(ctx context.Context) (redis.Conn, error) {
+	if len(it.nodes) > 0 {
+		return it.cli.cluster.getConnByAddrContext(ctx, it.nodes[it.node])
+	}
+	return it.cli.getConnContext(ctx)
+}
+
+// DeleteByPattern 通过SCAN 查找匹配pattern 的key，并按批次UNLINK 删除，返回删除的key 数量
+/**
+batchSize 为每批删除的数量（同时作为SCAN 的COUNT），<=0 时默认100；
+interval 为两批之间的间隔，用于限制对redis 的压力。
+UNLINK 在后台线程中释放内存（>= 4.0）。
+*/
+func (r *Redis) DeleteByPattern(ctx context.Context, pattern string, batchSize int, interval time.Duration) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	var total int64
+	batch := make([]string, 0, batchSize)
+	flush := func() error {
+		n, err := r.unlink(ctx, batch)
+		total += n
+		batch = batch[:0]
+		return err
+	}
+
+	it := r.Scan(ScanWithMatch(pattern), ScanWithCount(batchSize))
+	for it.Next(ctx) {
+		batch = append(batch, it.Val())
+		if len(batch) < batchSize {
+			continue
+		}
+		if err := flush(); err != nil {
+			return total, err
+		}
+
+		if interval > 0 {
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return total, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return total, err
+	}
+
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// unlink 删除keys，cluster 模式下按照槽位拆分
+func (r *Redis) unlink(ctx context.Context, keys []string) (int64, error) {
+	groups := [][]string{keys}
+	if r.cluster != nil {
+		groups, _ = splitBySlot(keys)
+	}
+
+	var total int64
+	for _, group := range groups {
+		args := make([]interface{}, len(group))
+		for i := range group {
+			args[i] = group[i]
+		}
+		n, err := redis.Int64(r.ExecCommandCtx(ctx, "UNLINK", args...))
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
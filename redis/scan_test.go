@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	// 共5 个key，每次SCAN 返回2 个
+	keys := []string{"test_scan:1", "test_scan:2", "test_scan:3", "test_scan:4", "test_scan:5"}
+	var (
+		mu       sync.Mutex
+		unlinked []string
+	)
+	addr := fakeServer(t, func(args []string) string {
+		switch args[0] {
+		case "SCAN":
+			var cursor int
+			fmt.Sscan(args[1], &cursor)
+			end, next := cursor+2, cursor+2
+			if end >= len(keys) {
+				end, next = len(keys), 0
+			}
+			reply := fmt.Sprintf("*2\r\n$%d\r\n%d\r\n*%d\r\n", len(fmt.Sprint(next)), next, end-cursor)
+			for _, key := range keys[cursor:end] {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+			}
+			return reply
+		case "UNLINK":
+			mu.Lock()
+			unlinked = append(unlinked, args[1:]...)
+			mu.Unlock()
+			return fmt.Sprintf(":%d\r\n", len(args)-1)
+		default:
+			return "+OK\r\n"
+		}
+	})
+
+	redisClient, err := NewRedis(&RedisConfig{Address: []string{addr}, MaxIdle: 4, MaxActive: 64})
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	ctx := context.Background()
+	var got []string
+	it := redisClient.Scan(ScanWithMatch("test_scan:*"), ScanWithCount(2))
+	for it.Next(ctx) {
+		got = append(got, it.Val())
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("Scan err: %v.", err)
+		return
+	}
+	if fmt.Sprint(got) != fmt.Sprint(keys) {
+		t.Errorf("Scan unexpected keys: %v.", got)
+		return
+	}
+
+	n, err := redisClient.DeleteByPattern(ctx, "test_scan:*", 2, 0)
+	if err != nil {
+		t.Errorf("Delete by pattern err: %v.", err)
+		return
+	}
+	if n != int64(len(keys)) || fmt.Sprint(unlinked) != fmt.Sprint(keys) {
+		t.Errorf("Delete by pattern unexpected result: %d, %v.", n, unlinked)
+		return
+	}
+}
@@ -0,0 +1,288 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FZambia/sentinel"
+	"github.com/gomodule/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMasterName 历史配置（IsCluster）使用的master 名称
+const defaultMasterName = "mymaster"
+
+// defaultSentinelCheckInterval 默认检测master 切换的间隔
+const defaultSentinelCheckInterval = time.Second
+
+// sentinelClient 哨兵客户端，全局共享一个sentinel.Sentinel，并定时检测master 是否切换
+type sentinelClient struct {
+	cfg      *RedisConfig
+	sntnl    *sentinel.Sentinel
+	interval time.Duration // 检测master 切换及借出连接时检查角色的间隔
+
+	mu     sync.RWMutex
+	master string      // 当前master 地址
+	pool   *redis.Pool // 当前master 的连接池，master 切换时替换
+	closed bool
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// newSentinelClient 新建哨兵客户端
+func newSentinelClient(cfg *RedisConfig) (*sentinelClient, error) {
+	addrs := cfg.SentinelAddrs
+	masterName := cfg.MasterName
+	if len(addrs) == 0 {
+		// 兼容历史配置：哨兵地址配置在Address 中
+		addrs = cfg.Address
+	}
+	if masterName == "" && cfg.IsCluster {
+		masterName = defaultMasterName
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("[redis]sentinel address is empty")
+	}
+	if masterName == "" {
+		return nil, errors.New("[redis]sentinel master name is empty")
+	}
+
+	s := &sentinelClient{
+		cfg: cfg,
+		sntnl: &sentinel.Sentinel{
+			Addrs:      addrs,
+			MasterName: masterName,
+			Dial: func(addr string) (redis.Conn, error) {
+				opts := []redis.DialOption{
+					redis.DialConnectTimeout(cfg.ConnectTimeout),
+					redis.DialReadTimeout(cfg.ReadTimeout),
+					redis.DialWriteTimeout(cfg.WriteTimeout),
+				}
+				if cfg.SentinelPassword != "" {
+					opts = append(opts, redis.DialPassword(cfg.SentinelPassword))
+				}
+				return redis.Dial("tcp", addr, opts...)
+			},
+		},
+		interval: cfg.SentinelCheckInterval,
+		stopCh:   make(chan struct{}),
+	}
+	if s.interval <= 0 {
+		s.interval = defaultSentinelCheckInterval
+	}
+
+	master, err := s.sntnl.MasterAddr()
+	if err != nil {
+		_ = s.sntnl.Close()
+		return nil, err
+	}
+	s.master = master
+	s.pool = s.newMasterPool(master)
+
+	go s.watch()
+	return s, nil
+}
+
+// masterAddr 获取当前master 地址
+func (s *sentinelClient) masterAddr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.master
+}
+
+// masterPool 获取当前master 的连接池
+func (s *sentinelClient) masterPool() *redis.Pool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pool
+}
+
+// checkMaster 向哨兵查询master 地址，发生切换时替换master 连接池
+/**
+旧连接池的空闲连接立即关闭，正在使用的连接归还时关闭。
+*/
+func (s *sentinelClient) checkMaster() (string, error) {
+	master, err := s.sntnl.MasterAddr()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	old := s.master
+	s.master = master
+	var stale *redis.Pool
+	if old != master && !s.closed {
+		stale = s.pool
+		s.pool = s.newMasterPool(master)
+	}
+	s.mu.Unlock()
+
+	if old != master {
+		logrus.Warnf("[redis]sentinel master '%s' switched from '%s' to '%s'.", s.sntnl.MasterName, old, master)
+	}
+	if stale != nil {
+		_ = stale.Close()
+	}
+	return master, nil
+}
+
+// watch 定时检测master 切换
+func (s *sentinelClient) watch() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			if _, err := s.checkMaster(); err != nil {
+				logrus.Errorf("[redis]sentinel get master '%s' addr err: %v.", s.sntnl.MasterName, err)
+			}
+		}
+	}
+}
+
+// newMasterPool 新建master 连接池，只连接master 地址
+/**
+master 切换由watch 定时检测并替换连接池，新建连接时不查询哨兵。
+*/
+func (s *sentinelClient) newMasterPool(master string) *redis.Pool {
+	cfg := s.cfg
+	return &redis.Pool{
+		MaxIdle:     cfg.MaxIdle,
+		MaxActive:   cfg.MaxActive,
+		IdleTimeout: cfg.IdleTimeout,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return dialNode(ctx, cfg, master)
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			// master 已切换，丢弃旧master 的连接
+			if nc, ok := c.(*nodeConn); ok && nc.addr != s.masterAddr() {
+				return errors.New("[redis]sentinel master switched")
+			}
+			// 最近使用过的连接不再检查角色，避免每次借出都多一次ROLE 往返
+			if time.Since(t) < s.interval {
+				return nil
+			}
+			if !sentinel.TestRole(c, "master") {
+				return errors.New("[redis]sentinel role check failed")
+			}
+			return nil
+		},
+	}
+}
+
+// newReplicaPool 新建replica 连接池，无可用replica 时使用master
+func (s *sentinelClient) newReplicaPool() *redis.Pool {
+	cfg := s.cfg
+	return &redis.Pool{
+		MaxIdle:     cfg.MaxIdle,
+		MaxActive:   cfg.MaxActive,
+		IdleTimeout: cfg.IdleTimeout,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			replicas, err := s.sntnl.SlaveAddrs()
+			if err != nil || len(replicas) == 0 {
+				return dialNode(ctx, cfg, s.masterAddr())
+			}
+			return dialNode(ctx, cfg, replicas[rand.Intn(len(replicas))])
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+// close 停止检测并关闭哨兵连接及master 连接池
+func (s *sentinelClient) close() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		_ = s.sntnl.Close()
+
+		s.mu.Lock()
+		s.closed = true
+		pool := s.pool
+		s.mu.Unlock()
+		_ = pool.Close()
+	})
+}
+
+// nodeConn 记录连接所属节点地址的redis.Conn
+type nodeConn struct {
+	redis.Conn
+	addr string
+}
+
+// DoWithTimeout 实现redis.ConnWithTimeout
+func (c *nodeConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+// ReceiveWithTimeout 实现redis.ConnWithTimeout
+func (c *nodeConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+// DoContext 实现redis.ConnWithContext
+/**
+ctx 中带有blockingTimeoutKey（阻塞命令）时，读超时使用该值而不受连接ReadTimeout 的限制，
+ctx 取消时关闭连接使读取立即返回，连接归还时不会放回连接池。
+*/
+func (c *nodeConn) DoContext(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	timeout, ok := ctx.Value(blockingTimeoutKey{}).(time.Duration)
+	if !ok {
+		return redis.DoContext(c.Conn, ctx, cmd, args...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+		done <- result{reply: reply, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		_ = c.Conn.Close()
+		<-done
+		return nil, ctx.Err()
+	case res := <-done:
+		return res.reply, res.err
+	}
+}
+
+// ReceiveContext 实现redis.ConnWithContext
+func (c *nodeConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return redis.ReceiveContext(c.Conn, ctx)
+}
+
+// readOnlyCommands 可以在replica 上执行的只读命令
+var readOnlyCommands = map[string]bool{
+	"GET": true, "MGET": true, "STRLEN": true, "GETRANGE": true, "EXISTS": true, "TYPE": true,
+	"TTL": true, "PTTL": true, "KEYS": true, "SCAN": true,
+	"HGET": true, "HMGET": true, "HGETALL": true, "HEXISTS": true, "HLEN": true, "HKEYS": true, "HVALS": true, "HSCAN": true,
+	"LRANGE": true, "LLEN": true, "LINDEX": true,
+	"SMEMBERS": true, "SISMEMBER": true, "SCARD": true, "SSCAN": true,
+	"ZSCORE": true, "ZRANGE": true, "ZREVRANGE": true, "ZRANGEBYSCORE": true, "ZREVRANGEBYSCORE": true,
+	"ZCARD": true, "ZCOUNT": true, "ZRANK": true, "ZREVRANK": true, "ZSCAN": true,
+}
+
+// isReadOnlyCommand 是否为只读命令
+func isReadOnlyCommand(command string) bool {
+	return readOnlyCommands[strings.ToUpper(command)]
+}
@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSentinel(t *testing.T) {
+
+	// 获取Redis（sentinel 模式）
+	var cfg = &RedisConfig{
+		Password:         "yZY0G0Dzh5N",
+		DatabaseId:       0,
+		MaxIdle:          4,
+		MaxActive:        64,
+		IdleTimeout:      time.Duration(5000) * time.Millisecond,
+		ConnectTimeout:   time.Duration(5000) * time.Millisecond,
+		ReadTimeout:      time.Duration(5000) * time.Millisecond,
+		WriteTimeout:     time.Duration(180) * time.Second,
+		Mode:             ModeSentinel,
+		MasterName:       "mymaster",
+		SentinelAddrs:    []string{"10.171.5.193:26379"},
+		SentinelPassword: "",
+		ReadFromReplica:  true,
+	}
+
+	redisClient, err := NewRedis(cfg)
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+
+	// 关闭redis
+	defer redisClient.ClosePool()
+	t.Log(redisClient.MasterAddr())
+
+	set, err := redisClient.SET("field_sentinel", "value_sentinel", SetWithEX(5))
+	if err != nil || set != "OK" {
+		t.Errorf("Redis set err: %v, reply: %s.", err, set)
+		return
+	}
+
+	// 从replica 读取
+	val, err := redisClient.GET("field_sentinel")
+	if err != nil {
+		t.Errorf("Redis get err: %v.", err)
+		return
+	}
+	t.Log(val)
+}
+
+func TestIsReadOnlyCommand(t *testing.T) {
+	if !isReadOnlyCommand("get") || !isReadOnlyCommand("HGETALL") {
+		t.Errorf("GET/HGETALL should be read only.")
+		return
+	}
+	if isReadOnlyCommand("SET") || isReadOnlyCommand("EVALSHA") {
+		t.Errorf("SET/EVALSHA should not be read only.")
+		return
+	}
+}
@@ -0,0 +1,341 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultStreamBlock        = 2 * time.Second
+	defaultStreamCount        = 10
+	defaultStreamClaimMinIdle = time.Minute
+	defaultStreamClaimEvery   = 30 * time.Second
+)
+
+// StreamMessage stream 消息
+type StreamMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// Stream Redis Streams
+type Stream struct {
+	streamName string
+	cli        *Redis
+	maxLen     int64 // XADD 时的MAXLEN，<=0 表示不裁剪
+}
+
+// NewStream 新建stream，stream key 为："STREAM:"+streamName
+/**
+maxLen > 0 时XADD 会按照MAXLEN ~ maxLen 近似裁剪。
+*/
+func NewStream(streamName string, client *Redis, maxLen int64) *Stream {
+	return &Stream{streamName: "STREAM:" + streamName, cli: client, maxLen: maxLen}
+}
+
+// XADD 添加消息，返回消息id
+func (s *Stream) XADD(ctx context.Context, values map[string]interface{}) (string, error) {
+	args := make([]interface{}, 0, len(values)*2+5)
+	args = append(args, s.streamName)
+	if s.maxLen > 0 {
+		args = append(args, "MAXLEN", "~", s.maxLen)
+	}
+	args = append(args, "*")
+	for k, v := range values {
+		args = append(args, k, v)
+	}
+	return redis.String(s.cli.ExecCommandCtx(ctx, "XADD", args...))
+}
+
+// XLEN 获取消息数量
+func (s *Stream) XLEN(ctx context.Context) (int64, error) {
+	return redis.Int64(s.cli.ExecCommandCtx(ctx, "XLEN", s.streamName))
+}
+
+// XDEL 删除消息
+func (s *Stream) XDEL(ctx context.Context, ids ...string) (int, error) {
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, s.streamName)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return redis.Int(s.cli.ExecCommandCtx(ctx, "XDEL", args...))
+}
+
+// CreateGroup 创建消费组（stream 不存在时自动创建），消费组已存在时忽略
+/**
+startID："$" 只消费新消息，"0" 从头消费。
+*/
+func (s *Stream) CreateGroup(ctx context.Context, group, startID string) error {
+	_, err := s.cli.ExecCommandCtx(ctx, "XGROUP", "CREATE", s.streamName, group, startID, "MKSTREAM")
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// DestroyGroup 删除消费组
+func (s *Stream) DestroyGroup(ctx context.Context, group string) error {
+	_, err := s.cli.ExecCommandCtx(ctx, "XGROUP", "DESTROY", s.streamName, group)
+	return err
+}
+
+// XREADGROUP 以消费组方式读取新消息，没有消息时最多阻塞block
+/**
+block <= 0 时不阻塞；没有消息时返回空切片。
+*/
+func (s *Stream) XREADGROUP(ctx context.Context, group, consumer string, count int, block time.Duration) ([]StreamMessage, error) {
+	args := []interface{}{"GROUP", group, consumer, "COUNT", count}
+	if block > 0 {
+		args = append(args, "BLOCK", block.Milliseconds())
+	}
+	args = append(args, "STREAMS", s.streamName, ">")
+
+	reply, err := s.cli.execBlocking(ctx, block, "XREADGROUP", args...)
+	if err == redis.ErrNil || (err == nil && reply == nil) {
+		return []StreamMessage{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]StreamMessage, 0)
+	for _, st := range streams {
+		item, err := redis.Values(st, nil)
+		if err != nil || len(item) != 2 {
+			return nil, errors.New("[redis]invalid xreadgroup reply")
+		}
+		ms, err := parseStreamMessages(item[1])
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, ms...)
+	}
+	return msgs, nil
+}
+
+// XACK 确认消息
+func (s *Stream) XACK(ctx context.Context, group string, ids ...string) (int, error) {
+	args := make([]interface{}, 0, len(ids)+2)
+	args = append(args, s.streamName, group)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return redis.Int(s.cli.ExecCommandCtx(ctx, "XACK", args...))
+}
+
+// XPENDING 获取消费组未确认消息数量
+func (s *Stream) XPENDING(ctx context.Context, group string) (int64, error) {
+	values, err := redis.Values(s.cli.ExecCommandCtx(ctx, "XPENDING", s.streamName, group))
+	if err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	return redis.Int64(values[0], nil)
+}
+
+// XAUTOCLAIM 将空闲超过minIdle 的未确认消息转移给consumer（>= 6.2）
+/**
+返回下一次扫描的起始id（"0-0" 表示已扫描完）以及转移成功的消息。
+*/
+func (s *Stream) XAUTOCLAIM(ctx context.Context, group, consumer string, minIdle time.Duration, start string, count int) (string, []StreamMessage, error) {
+	values, err := redis.Values(s.cli.ExecCommandCtx(ctx, "XAUTOCLAIM", s.streamName, group, consumer,
+		minIdle.Milliseconds(), start, "COUNT", count))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(values) < 2 {
+		return "", nil, errors.New("[redis]invalid xautoclaim reply")
+	}
+
+	next, err := redis.String(values[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	msgs, err := parseStreamMessages(values[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return next, msgs, nil
+}
+
+// Clear 删除stream
+func (s *Stream) Clear() error {
+	_, err := s.cli.ExecCommand("DEL", s.streamName)
+	return err
+}
+
+// parseStreamMessages 解析[[id, [field, value, ...]], ...]
+func parseStreamMessages(reply interface{}) ([]StreamMessage, error) {
+	entries, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]StreamMessage, 0, len(entries))
+	for _, e := range entries {
+		entry, err := redis.Values(e, nil)
+		if err != nil || len(entry) != 2 {
+			return nil, errors.New("[redis]invalid stream entry")
+		}
+		id, err := redis.String(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		// 消息已被XDEL 时字段为nil
+		if entry[1] == nil {
+			continue
+		}
+		values, err := redis.StringMap(entry[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, StreamMessage{ID: id, Values: values})
+	}
+	return msgs, nil
+}
+
+// blockingTimeoutKey ctx 中阻塞命令的读超时时间，由nodeConn.DoContext 使用
+type blockingTimeoutKey struct{}
+
+// execBlocking 执行阻塞命令，读超时时间为block + ReadTimeout
+/**
+读超时不受连接ReadTimeout 的限制（block 可以大于ReadTimeout）；
+ctx 取消时关闭底层连接使命令立即返回，该连接不会放回连接池，
+被丢弃的回复中XREADGROUP 读取到的消息保留在pending 中，等待重新认领。
+*/
+func (r *Redis) execBlocking(ctx context.Context, block time.Duration, command string, args ...interface{}) (interface{}, error) {
+	rc, err := r.getConnContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	timeout := time.Duration(0)
+	if r.cfg != nil && r.cfg.ReadTimeout > 0 {
+		timeout = block + r.cfg.ReadTimeout
+	}
+	return redis.DoContext(rc, context.WithValue(ctx, blockingTimeoutKey{}, timeout), command, args...)
+}
+
+// StreamHandler 消息处理函数，返回nil 时确认消息，返回error 时消息保留在pending 中，等待重新认领
+type StreamHandler func(ctx context.Context, msg StreamMessage) error
+
+// StreamConsumer 消费组中长期运行的消费者
+type StreamConsumer struct {
+	stream   *Stream
+	group    string
+	consumer string
+	handler  StreamHandler
+
+	Count        int           // 每次读取的消息数量，默认10
+	Block        time.Duration // 没有消息时阻塞时间，默认2s
+	ClaimMinIdle time.Duration // 认领其他消费者空闲超过该时间的pending 消息，默认1min，<0 表示不认领
+	ClaimEvery   time.Duration // 认领pending 消息的间隔，默认30s
+}
+
+// NewConsumer 新建消费者
+func (s *Stream) NewConsumer(group, consumer string, handler StreamHandler) *StreamConsumer {
+	return &StreamConsumer{
+		stream:       s,
+		group:        group,
+		consumer:     consumer,
+		handler:      handler,
+		Count:        defaultStreamCount,
+		Block:        defaultStreamBlock,
+		ClaimMinIdle: defaultStreamClaimMinIdle,
+		ClaimEvery:   defaultStreamClaimEvery,
+	}
+}
+
+// Run 阻塞消费消息，ctx 取消后处理完当前批次并返回
+/**
+启动时会创建消费组（从"$" 开始），并定期通过XAUTOCLAIM 认领已下线消费者的pending 消息。
+*/
+func (c *StreamConsumer) Run(ctx context.Context) error {
+	if c.handler == nil {
+		return errors.New("[redis]stream handler is nil")
+	}
+	if err := c.stream.CreateGroup(ctx, c.group, "$"); err != nil {
+		return err
+	}
+
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		// 认领pending 消息
+		if c.ClaimMinIdle >= 0 && time.Since(lastClaim) >= c.ClaimEvery {
+			lastClaim = time.Now()
+			c.claim(ctx)
+		}
+
+		msgs, err := c.stream.XREADGROUP(ctx, c.group, c.consumer, c.Count, c.Block)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			logrus.Errorf("[redis]stream '%s' group '%s' read err: %v.", c.stream.streamName, c.group, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		c.handle(ctx, msgs)
+	}
+	return nil
+}
+
+// claim 认领空闲超时的pending 消息并处理
+func (c *StreamConsumer) claim(ctx context.Context) {
+	start := "0-0"
+	for ctx.Err() == nil {
+		next, msgs, err := c.stream.XAUTOCLAIM(ctx, c.group, c.consumer, c.ClaimMinIdle, start, c.Count)
+		if err != nil {
+			logrus.Errorf("[redis]stream '%s' group '%s' autoclaim err: %v.", c.stream.streamName, c.group, err)
+			return
+		}
+		c.handle(ctx, msgs)
+		// 消息被删除时可能返回空批次但游标未结束，只有游标为"0-0" 时才扫描完毕
+		if next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+// handle 处理消息，成功后确认
+/**
+ctx 取消后仍会将本批次的消息交给handler（handler 可根据ctx 提前返回），处理成功的消息照常确认。
+*/
+func (c *StreamConsumer) handle(ctx context.Context, msgs []StreamMessage) {
+	for _, msg := range msgs {
+		err := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("[redis]stream handler panic: %v", r)
+				}
+			}()
+			return c.handler(ctx, msg)
+		}()
+		if err != nil {
+			logrus.Errorf("[redis]stream '%s' group '%s' handle message '%s' err: %v.", c.stream.streamName, c.group, msg.ID, err)
+			continue
+		}
+
+		if _, err := c.stream.XACK(context.Background(), c.group, msg.ID); err != nil {
+			logrus.Errorf("[redis]stream '%s' group '%s' ack message '%s' err: %v.", c.stream.streamName, c.group, msg.ID, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestStream(t *testing.T) {
+
+	// 获取Redis
+	var cfg = &RedisConfig{
+		Password:       "yZY0G0Dzh5N",
+		Address:        []string{"10.171.5.193:6382"},
+		DatabaseId:     0,
+		MaxIdle:        4,
+		MaxActive:      64,
+		IdleTimeout:    time.Duration(5000) * time.Millisecond,
+		ConnectTimeout: time.Duration(5000) * time.Millisecond,
+		ReadTimeout:    time.Duration(5000) * time.Millisecond,
+		WriteTimeout:   time.Duration(180) * time.Second,
+	}
+
+	redisClient, err := NewRedis(cfg)
+	if err != nil {
+		t.Errorf("Redis connect failed, err: %v.", err)
+		return
+	}
+	defer redisClient.ClosePool()
+
+	// 获取Stream
+	stream := NewStream("test_stream", redisClient, 1000)
+	defer stream.Clear()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := stream.CreateGroup(ctx, "test_group", "0"); err != nil {
+		t.Errorf("Stream create group err: %v.", err)
+		return
+	}
+
+	// XADD 方法
+	for i := 0; i < 3; i++ {
+		id, err := stream.XADD(ctx, map[string]interface{}{"index": i})
+		if err != nil {
+			t.Errorf("Stream xadd err: %v.", err)
+			return
+		}
+		t.Log(id)
+	}
+
+	// 消费
+	var handled int32
+	consumer := stream.NewConsumer("test_group", "consumer_1", func(ctx context.Context, msg StreamMessage) error {
+		atomic.AddInt32(&handled, 1)
+		t.Log(msg.ID, msg.Values)
+		return nil
+	})
+	consumer.Block = 200 * time.Millisecond
+
+	runCtx, stop := context.WithTimeout(ctx, time.Second)
+	defer stop()
+	if err := consumer.Run(runCtx); err != nil {
+		t.Errorf("Stream consumer run err: %v.", err)
+		return
+	}
+
+	if n := atomic.LoadInt32(&handled); n != 3 {
+		t.Errorf("Stream handled %d messages, want 3.", n)
+		return
+	}
+
+	pending, err := stream.XPENDING(ctx, "test_group")
+	if err != nil || pending != 0 {
+		t.Errorf("Stream xpending err: %v, pending: %d.", err, pending)
+		return
+	}
+}
+
+func TestParseStreamMessages(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{[]byte("1-0"), []interface{}{[]byte("k"), []byte("v")}},
+		[]interface{}{[]byte("2-0"), nil},
+	}
+
+	msgs, err := parseStreamMessages(reply)
+	if err != nil || len(msgs) != 1 || msgs[0].ID != "1-0" || msgs[0].Values["k"] != "v" {
+		t.Errorf("Parse stream messages err: %v, msgs: %v.", err, msgs)
+		return
+	}
+}
+
+func TestExecBlockingCancel(t *testing.T) {
+	// 服务端只读取不回复，模拟阻塞中的XREADGROUP
+	pool := &redis.Pool{
+		MaxIdle: 1,
+		Dial: func() (redis.Conn, error) {
+			client, server := net.Pipe()
+			go func() { _, _ = io.Copy(io.Discard, server) }()
+			return &nodeConn{Conn: redis.NewConn(client, 0, 0), addr: "pipe"}, nil
+		},
+	}
+	defer pool.Close()
+	r := &Redis{cfg: &RedisConfig{ReadTimeout: time.Second}, redisPool: pool}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := r.execBlocking(ctx, time.Minute, "XREADGROUP", "GROUP", "g", "c", "BLOCK", 60000, "STREAMS", "s", ">"); err != context.DeadlineExceeded {
+		t.Errorf("Exec blocking err: %v, want context.DeadlineExceeded.", err)
+		return
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Exec blocking should return after ctx done, took %v.", d)
+		return
+	}
+
+	// 被取消的连接已关闭，不会放回连接池
+	if s := pool.Stats(); s.ActiveCount != 0 || s.IdleCount != 0 {
+		t.Errorf("Canceled conn should be closed, pool stats: %+v.", s)
+		return
+	}
+}
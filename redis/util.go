@@ -11,6 +11,15 @@ type setArgs []interface{}
 // SetOption Set 额外参数
 type SetOption func(args setArgs) setArgs
 
+// buildSetArgs 根据SetOption 构造SET 参数
+func buildSetArgs(key string, value interface{}, options []SetOption) setArgs {
+	args := setArgs{key, value}
+	for _, f := range options {
+		args = f(args)
+	}
+	return args
+}
+
 // SetWithEX
 /**
 设置指定的过期时间，以秒为单位